@@ -185,10 +185,13 @@ func (g *gen) generate() ([]byte, error) {
 	}
 
 	// Make a topologically sorted list of structs.
+	//
+	// TODO: generate generic structs and funcs, once they can be instantiated.
+	// Until then, they have no C form.
 	unsortedStructs := []*a.Struct(nil)
 	for _, file := range g.files {
 		for _, tld := range file.TopLevelDecls() {
-			if tld.Kind() == a.KStruct {
+			if tld.Kind() == a.KStruct && len(tld.Struct().TypeParams()) == 0 {
 				unsortedStructs = append(unsortedStructs, tld.Struct())
 			}
 		}
@@ -389,7 +392,7 @@ func (g *gen) forEachConst(b *buffer, v visibility, f func(*gen, *buffer, *a.Con
 func (g *gen) forEachFunc(b *buffer, v visibility, f func(*gen, *buffer, *a.Func) error) error {
 	for _, file := range g.files {
 		for _, tld := range file.TopLevelDecls() {
-			if tld.Kind() != a.KFunc ||
+			if tld.Kind() != a.KFunc || len(tld.Func().TypeParams()) != 0 ||
 				(v == pubOnly && tld.Raw().Flags()&a.FlagsPublic == 0) ||
 				(v == priOnly && tld.Raw().Flags()&a.FlagsPublic != 0) {
 				continue
@@ -432,6 +435,24 @@ func (g *gen) forEachUse(b *buffer, f func(*gen, *buffer, *a.Use) error) error {
 	return nil
 }
 
+// otherPkgPrefix returns the C prefix, such as "wuffs_deflate__", for a used
+// package's names, given the name that the Wuffs code refers to it by. That
+// name is usually the base name of the used package's path, so that
+// "deflate.decoder" maps to "wuffs_deflate__decoder", but `use "foo/bar" as
+// baz` instead maps "baz.qux" to "wuffs_bar__qux".
+func (g *gen) otherPkgPrefix(pkg t.ID) string {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KUse || tld.Use().Alias() != pkg {
+				continue
+			}
+			useDirname, _ := t.Unescape(g.tm.ByID(tld.Use().Path()))
+			return "wuffs_" + path.Base(useDirname) + "__"
+		}
+	}
+	return "wuffs_" + g.tm.ByID(pkg) + "__"
+}
+
 func (g *gen) cName(name string) string {
 	s := []byte(g.pkgPrefix)
 	underscore := true
@@ -509,8 +530,6 @@ func (g *gen) writeConst(b *buffer, n *a.Const) error {
 
 func (g *gen) writeConstList(b *buffer, n *a.Expr) error {
 	switch n.Operator().Key() {
-	case 0:
-		b.writes(n.ConstValue().String())
 	case t.KeyDollar:
 		b.writeb('{')
 		for _, o := range n.Args() {
@@ -521,7 +540,12 @@ func (g *gen) writeConstList(b *buffer, n *a.Expr) error {
 		}
 		b.writeb('}')
 	default:
-		return fmt.Errorf("invalid const value %q", n.Str(g.tm))
+		// Literals, and calls evaluated at compile time, have a ConstValue.
+		cv := n.ConstValue()
+		if cv == nil {
+			return fmt.Errorf("invalid const value %q", n.Str(g.tm))
+		}
+		b.writes(cv.String())
 	}
 	return nil
 }
@@ -711,9 +735,8 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 		prefix := g.pkgPrefix
 		qid := x.QID()
 		if qid[0] != 0 {
-			// See gen.writeCTypeName for a related TODO with otherPkg.
-			otherPkg := g.tm.ByID(qid[0])
-			prefix = "wuffs_" + otherPkg + "__"
+			// See gen.writeCTypeName for a related TODO with otherPkgPrefix.
+			prefix = g.otherPkgPrefix(qid[0])
 		} else if g.structMap[qid] == nil {
 			// Skip field types like u32 and bool.
 			continue
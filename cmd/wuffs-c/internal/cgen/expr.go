@@ -86,6 +86,12 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, pp pare
 	case 0:
 		if id1 := n.Ident(); id1.Key() == t.KeyThis {
 			b.writes("self")
+		} else if id1.IsStrLiteral() {
+			// The checker only allows a string literal to initialize an array,
+			// which writeStatement handles, or as the receiver of a constant
+			// ".length()". C string literals are read-only, but a
+			// wuffs_base__slice_u8 is writable.
+			return fmt.Errorf("internal error: string literal %s as a slice value", id1.Str(g.tm))
 		} else {
 			if n.GlobalIdent() {
 				b.writes(g.pkgPrefix)
@@ -98,6 +104,9 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, rp replacementPolicy, pp pare
 
 	case t.KeyOpenParen:
 		// n is a function call.
+		if name := builtin.NumFuncName(g.tm, n); name != "" {
+			return g.writeBuiltInNumCall(b, n, name, rp, depth)
+		}
 		// TODO: delete this hack that only matches "foo.bar_bits(etc)".
 		if isThatMethod(g.tm, n, t.KeyLowBits, 1) {
 			// "x.low_bits(n:etc)" in C is "((x) & ((1 << (n)) - 1))".
@@ -570,6 +579,11 @@ func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, var
 		return fmt.Errorf("cannot convert Wuffs type %q to C", n.Str(g.tm))
 	}
 
+	if len(innermost.TypeArgs()) != 0 {
+		// TODO: generate C code for instantiated generic structs.
+		return fmt.Errorf("cannot convert Wuffs type %q to C", n.Str(g.tm))
+	}
+
 	fallback := true
 	if qid := innermost.QID(); qid[0] == 0 {
 		if key := qid[1].Key(); key < t.Key(len(cTypeNames)) {
@@ -583,19 +597,11 @@ func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, var
 		prefix := g.pkgPrefix
 		qid := innermost.QID()
 		if qid[0] != 0 {
-			otherPkg := g.tm.ByID(qid[0])
-			// TODO: map the "deflate" in "deflate.decoder" to the "deflate" in
-			// `use "std/deflate"`, and use the latter "deflate".
-			//
-			// This is pretty academic at the moment, since they're the same
-			// "deflate", but in the future, we might be able to rename used
-			// packages, e.g. `use "foo/bar" as "baz"`, so "baz.qux" would map
-			// to generating "wuffs_bar__qux".
+			// TODO: sanitize or validate the other package's name, e.g. that
+			// it's ASCII only?
 			//
-			// TODO: sanitize or validate otherPkg, e.g. that it's ASCII only?
-			//
-			// See gen.writeInitializerImpl for a similar use of otherPkg.
-			prefix = "wuffs_" + otherPkg + "__"
+			// See gen.writeInitializerImpl for a similar use of otherPkgPrefix.
+			prefix = g.otherPkgPrefix(qid[0])
 		}
 		// TODO: remove this hack when "image_config" in Wuffs code becomes
 		// "base.image_config".
@@ -623,6 +629,132 @@ func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, var
 	return nil
 }
 
+func (g *gen) writeBuiltInNumCall(b *buffer, n *a.Expr, name string, rp replacementPolicy, depth uint32) error {
+	// The checker has already verified that the arguments are pure, so that
+	// evaluating them more than once is OK.
+	x := n.Args()[0].Arg().Value()
+	switch name {
+	case "assume_in_bounds":
+		// "assume_in_bounds(x:etc, lo:etc, hi:etc)" in C is "(x)", as its run
+		// time check, if any, is written before the enclosing statement.
+		b.writeb('(')
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.writeb(')')
+		return nil
+
+	case "abs":
+		// "abs(x:etc)" in C is "((uintN_t)(((x) < 0) ? -((uint64_t)(x)) :
+		// ((uint64_t)(x))))", where the uint64_t arithmetic avoids undefined
+		// behavior for the most negative intN_t value.
+		if !x.MType().IsUnsignedInteger() {
+			b.writes("((")
+			if err := g.writeCTypeName(b, n.MType(), "", ""); err != nil {
+				return err
+			}
+			b.writes(")(((")
+			if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+				return err
+			}
+			b.writes(") < 0) ? -((uint64_t)(")
+			if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+				return err
+			}
+			b.writes(")) : ((uint64_t)(")
+			if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+				return err
+			}
+			b.writes("))))")
+			return nil
+		}
+		b.writeb('(')
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.writeb(')')
+		return nil
+
+	case "sign":
+		// "sign(x:etc)" in C is "((int8_t)(((x) > 0) - ((x) < 0)))".
+		b.writes("((int8_t)(((")
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.writes(") > 0) - ((")
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.writes(") < 0)))")
+		return nil
+
+	case "clz", "popcount":
+		// "popcount(x:etc)" in C is "((uint8_t)(__builtin_popcountll(x)))".
+		// "clz(x:etc)" in C is "((uint8_t)((x) ? (__builtin_clzll(x) - (64 -
+		// N)) : N))" for an N-bit x, as __builtin_clzll(0) is undefined.
+		//
+		// TODO: support non-GCC, non-Clang compilers.
+		width := 0
+		switch x.MType().QID()[1].Key() {
+		case t.KeyU8:
+			width = 8
+		case t.KeyU16:
+			width = 16
+		case t.KeyU32:
+			width = 32
+		case t.KeyU64:
+			width = 64
+		default:
+			return fmt.Errorf("%s of %q, of type %q, is not supported",
+				name, x.Str(g.tm), x.MType().Str(g.tm))
+		}
+		if name == "popcount" {
+			b.writes("((uint8_t)(__builtin_popcountll(")
+			if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+				return err
+			}
+			b.writes(")))")
+			return nil
+		}
+		b.writes("((uint8_t)((")
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.writes(") ? (__builtin_clzll(")
+		if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+			return err
+		}
+		b.printf(") - %d) : %d))", 64-width, width)
+		return nil
+	}
+
+	// "min(a:x, b:y)" in C is "((x < y) ? (x) : (y))". Similarly, "max" uses
+	// ">" instead of "<".
+	op := " < "
+	if name == "max" {
+		op = " > "
+	}
+	y := n.Args()[1].Arg().Value()
+	b.writes("((")
+	if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+		return err
+	}
+	b.writes(op)
+	if err := g.writeExpr(b, y, rp, parenthesesOptional, depth); err != nil {
+		return err
+	}
+	b.writes(") ? (")
+	if err := g.writeExpr(b, x, rp, parenthesesOptional, depth); err != nil {
+		return err
+	}
+	b.writes(") : (")
+	if err := g.writeExpr(b, y, rp, parenthesesOptional, depth); err != nil {
+		return err
+	}
+	b.writes("))")
+	return nil
+}
+
 var cTypeNames = [...]string{
 	t.KeyI8:      "int8_t",
 	t.KeyI16:     "int16_t",
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/wuffs/lang/builtin"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -69,6 +71,10 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 		b.printf("// %s:%d\n", filename, line)
 	}
 
+	if err := g.writeAssumeInBoundsChecks(b, n, depth); err != nil {
+		return err
+	}
+
 	switch n.Kind() {
 	case a.KAssign:
 		n := n.Assign()
@@ -276,6 +282,14 @@ func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
 			}
 		}
 		if n.XType().Decorator().Key() == t.KeyOpenBracket {
+			if v := n.Value(); v != nil && v.Operator() == 0 && v.Ident().IsStrLiteral() {
+				// The checker has already verified that the array and the
+				// string literal have the same length.
+				name := n.Name().Str(g.tm)
+				b.printf("memcpy(%s%s, %s, sizeof(%s%s));\n",
+					vPrefix, name, v.Ident().Str(g.tm), vPrefix, name)
+				return nil
+			}
 			if n.Value() != nil {
 				// TODO: something like:
 				// cv := n.XType().ArrayLength().ConstValue()
@@ -855,3 +869,91 @@ func isThatMethod(tm *t.Map, n *a.Expr, methodName t.Key, nArgs int) bool {
 	n = n.LHS().Expr()
 	return n.Operator().Key() == t.KeyDot && n.Ident().Key() == methodName
 }
+
+// writeAssumeInBoundsChecks writes the run time checks for the
+// assume_in_bounds(x:etc, lo:etc, hi:etc) calls in the statement n that the
+// bounds checker could not prove. Each check is written before n, which is
+// OK because the checker has already verified that x is pure.
+func (g *gen) writeAssumeInBoundsChecks(b *buffer, n *a.Node, depth uint32) error {
+	exprs, inCondition := []*a.Expr(nil), false
+	switch n.Kind() {
+	case a.KAssign:
+		exprs = []*a.Expr{n.Assign().LHS(), n.Assign().RHS()}
+	case a.KExpr:
+		exprs = []*a.Expr{n.Expr()}
+	case a.KRet:
+		exprs = []*a.Expr{n.Ret().Value()}
+	case a.KVar:
+		exprs = []*a.Expr{n.Var().Value()}
+	case a.KIf:
+		for o := n.If(); o != nil; o = o.ElseIf() {
+			exprs = append(exprs, o.Condition())
+		}
+		inCondition = true
+	case a.KIterate:
+		for _, o := range n.Iterate().Variables() {
+			exprs = append(exprs, o.Var().Value())
+		}
+		inCondition = true
+	case a.KWhile:
+		exprs = []*a.Expr{n.While().Condition()}
+		inCondition = true
+	}
+
+	calls := []*a.Expr(nil)
+	for _, x := range exprs {
+		if x == nil {
+			continue
+		}
+		x.Node().Walk(func(o *a.Node) error {
+			if o.Kind() == a.KExpr {
+				if o := o.Expr(); !o.BoundsCheckOptimized() && builtin.NumFuncName(g.tm, o) == "assume_in_bounds" {
+					calls = append(calls, o)
+				}
+			}
+			return nil
+		})
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+	// TODO: allow run time checks in if, iterate and while conditions, and in
+	// functions that cannot return an error status.
+	if inCondition {
+		return fmt.Errorf("cannot generate the run time check for %q in a condition", calls[0].Str(g.tm))
+	}
+	if !g.currFunk.suspendible {
+		return fmt.Errorf("cannot generate the run time check for %q in a non-suspendible function",
+			calls[0].Str(g.tm))
+	}
+
+	for _, o := range calls {
+		args := o.Args()
+		x := args[0].Arg().Value()
+		b.writes("if (")
+		nConds := 0
+		for i, o := range args[1:] {
+			if i == 0 && x.MType().IsUnsignedInteger() && o.Arg().Value().ConstValue().Sign() == 0 {
+				// Avoid a "comparison is always false" compiler warning.
+				continue
+			}
+			if nConds != 0 {
+				b.writes(" || ")
+			}
+			nConds++
+			b.writeb('(')
+			if err := g.writeExpr(b, x, replaceNothing, parenthesesMandatory, depth); err != nil {
+				return err
+			}
+			if i == 0 {
+				b.writes(" < ")
+			} else {
+				b.writes(" > ")
+			}
+			b.writes(o.Arg().Value().ConstValue().String())
+			b.writeb(')')
+		}
+		b.printf(") { status = %sERROR_FAILED_ASSUMPTION; goto exit; }\n", g.PKGPREFIX)
+	}
+	return nil
+}
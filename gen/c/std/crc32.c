@@ -210,6 +210,7 @@ typedef int32_t wuffs_crc32__status;
 #define WUFFS_CRC32__ERROR_CANNOT_RETURN_A_SUSPENSION -2147483638  // 0x8000000A
 #define WUFFS_CRC32__ERROR_INVALID_CALL_SEQUENCE -2147483637       // 0x8000000B
 #define WUFFS_CRC32__SUSPENSION_END_OF_DATA 12                     // 0x0000000C
+#define WUFFS_CRC32__ERROR_FAILED_ASSUMPTION -2147483635           // 0x8000000D
 
 bool wuffs_crc32__status__is_error(wuffs_crc32__status s);
 
@@ -615,7 +616,7 @@ static inline wuffs_base__empty_struct wuffs_base__writer1__mark(
   return ((wuffs_base__empty_struct){});
 }
 
-static const char* wuffs_base__status__strings[13] = {
+static const char* wuffs_base__status__strings[14] = {
     "ok",
     "bad wuffs version",
     "bad receiver",
@@ -629,6 +630,7 @@ static const char* wuffs_base__status__strings[13] = {
     "cannot return a suspension",
     "invalid call sequence",
     "end of data",
+    "failed assumption",
 };
 
 #endif  // WUFFS_BASE_IMPL_H
@@ -647,7 +649,7 @@ const char* wuffs_crc32__status__string(wuffs_crc32__status s) {
   switch ((s >> 10) & 0x1FFFFF) {
     case 0:
       a = wuffs_base__status__strings;
-      n = 13;
+      n = 14;
       break;
     case wuffs_crc32__packageid:
       a = wuffs_crc32__status__strings;
@@ -49,6 +49,7 @@ const (
 	KStatus
 	KStruct
 	KTypeExpr
+	KTypeParam
 	KUse
 	KVar
 	KWhile
@@ -80,6 +81,7 @@ var kindStrings = [...]string{
 	KStatus:    "KStatus",
 	KStruct:    "KStruct",
 	KTypeExpr:  "KTypeExpr",
+	KTypeParam: "KTypeParam",
 	KUse:       "KUse",
 	KVar:       "KVar",
 	KWhile:     "KWhile",
@@ -97,6 +99,7 @@ const (
 	FlagsHasBreak        = Flags(0x00000040)
 	FlagsHasContinue     = Flags(0x00000080)
 	FlagsGlobalIdent     = Flags(0x00000100)
+	FlagsMutable         = Flags(0x00000200)
 )
 
 const (
@@ -170,6 +173,7 @@ type Node struct {
 	// Status        keyword       pkg           lit(message)  Status
 	// Struct        .             pkg           name          Struct
 	// TypeExpr      decorator     pkg           name          TypeExpr
+	// TypeParam     .             constraint    name          TypeParam
 	// Use           .             .             lit(path)     Use
 	// Var           operator      .             name          Var
 	// While         .             label         .             While
@@ -184,6 +188,14 @@ type Node struct {
 	list0 []*Node
 	list1 []*Node
 	list2 []*Node
+
+	// noWarn are the warning categories named by "// wuffs:nowarn" comments
+	// attached to this (statement or top level declaration) node.
+	noWarn []string
+
+	// buildIf is the condition of a "@[if cond]" attribute on this top level
+	// declaration, or nil if there is no such attribute.
+	buildIf *Expr
 }
 
 func (n *Node) Kind() Kind        { return n.kind }
@@ -207,6 +219,7 @@ func (n *Node) Ret() *Ret             { return (*Ret)(n) }
 func (n *Node) Status() *Status       { return (*Status)(n) }
 func (n *Node) Struct() *Struct       { return (*Struct)(n) }
 func (n *Node) TypeExpr() *TypeExpr   { return (*TypeExpr)(n) }
+func (n *Node) TypeParam() *TypeParam { return (*TypeParam)(n) }
 func (n *Node) Use() *Use             { return (*Use)(n) }
 func (n *Node) Var() *Var             { return (*Var)(n) }
 func (n *Node) While() *While         { return (*While)(n) }
@@ -248,10 +261,14 @@ type Raw Node
 func (n *Raw) Node() *Node                    { return (*Node)(n) }
 func (n *Raw) Flags() Flags                   { return n.flags }
 func (n *Raw) FilenameLine() (string, uint32) { return n.filename, n.line }
+func (n *Raw) NoWarn() []string               { return n.noWarn }
+func (n *Raw) BuildIf() *Expr                 { return n.buildIf }
 func (n *Raw) SubNodes() [3]*Node             { return [3]*Node{n.lhs, n.mhs, n.rhs} }
 func (n *Raw) SubLists() [3][]*Node           { return [3][]*Node{n.list0, n.list1, n.list2} }
 
 func (n *Raw) SetFilenameLine(f string, l uint32) { n.filename, n.line = f, l }
+func (n *Raw) SetNoWarn(x []string)               { n.noWarn = x }
+func (n *Raw) SetBuildIf(x *Expr)                 { n.buildIf = x }
 
 func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 	return n.Node().Walk(func(o *Node) error {
@@ -301,7 +318,7 @@ const MaxExprDepth = 255
 //  - FlagsSuspendible     is if it or a sub-expr is FlagsCallSuspendible
 //  - FlagsCallImpure      is "f(x)" vs "f!(x)"
 //  - FlagsCallSuspendible is "f(x)" vs "f?(x)", it implies FlagsCallImpure
-//  - ID0:   <0|operator|IDOpenParen|IDOpenBracket|IDColon|IDDot>
+//  - ID0:   <0|operator|IDOpenParen|IDOpenBracket|IDColon|IDDot|IDSizeof>
 //  - ID1:   <0|pkg> (for statuses)
 //  - ID2:   <0|literal|ident>
 //  - LHS:   <nil|Expr>
@@ -332,6 +349,8 @@ const MaxExprDepth = 255
 //
 // For lists, like "$(0, 1, 2)", ID0 is IDDollar.
 //
+// For sizes, like "sizeof(RHS)", ID0 is IDSizeof and RHS is a TypeExpr.
+//
 // For statuses, like `error "foo"` and `suspension bar."baz"`, ID0 is the
 // keyword, ID1 is the package and ID2 is the message.
 type Expr Node
@@ -356,6 +375,7 @@ func (n *Expr) MHS() *Node                 { return n.mhs }
 func (n *Expr) RHS() *Node                 { return n.rhs }
 func (n *Expr) Args() []*Node              { return n.list0 }
 
+func (n *Expr) SetArgs(x []*Node)        { n.list0 = x }
 func (n *Expr) SetBoundsCheckOptimized() { n.flags |= FlagsBoundsCheckOptimized }
 func (n *Expr) SetConstValue(x *big.Int) { n.constValue = x }
 func (n *Expr) SetGlobalIdent()          { n.flags |= FlagsGlobalIdent }
@@ -449,12 +469,15 @@ func NewAssign(operator t.ID, lhs *Expr, rhs *Expr) *Assign {
 	}
 }
 
-// Var is "var ID2 LHS" or "var ID2 LHS = RHS" or an iterate variable
-// declaration "ID1 LHS : RHS":
+// Var is "var ID2 LHS" or "var ID2 LHS = RHS" or "var ID2 = RHS" or an
+// iterate variable declaration "ID1 LHS : RHS":
 //  - ID0:   <0|IDEq|IDColon>
 //  - ID2:   name
-//  - LHS:   <TypeExpr>
+//  - LHS:   <nil|TypeExpr>
 //  - RHS:   <nil|Expr>
+//
+// A nil LHS means that the type is inferred from the RHS. The type checker
+// sets the LHS to that inferred type.
 type Var Node
 
 func (n *Var) Node() *Node           { return (*Node)(n) }
@@ -463,6 +486,8 @@ func (n *Var) Name() t.ID            { return n.id2 }
 func (n *Var) XType() *TypeExpr      { return n.lhs.TypeExpr() }
 func (n *Var) Value() *Expr          { return n.rhs.Expr() }
 
+func (n *Var) SetXType(x *TypeExpr) { n.lhs = x.Node() }
+
 func NewVar(op t.ID, name t.ID, xType *TypeExpr, value *Expr) *Var {
 	return &Var{
 		kind: KVar,
@@ -474,22 +499,25 @@ func NewVar(op t.ID, name t.ID, xType *TypeExpr, value *Expr) *Var {
 }
 
 // Field is a "name type = default_value" struct field:
+//  - FlagsMutable is "var name type etc", an in-param that can be assigned to
 //  - ID2:   name
 //  - LHS:   <TypeExpr>
 //  - RHS:   <nil|Expr>
 type Field Node
 
 func (n *Field) Node() *Node         { return (*Node)(n) }
+func (n *Field) Mutable() bool       { return n.flags&FlagsMutable != 0 }
 func (n *Field) Name() t.ID          { return n.id2 }
 func (n *Field) XType() *TypeExpr    { return n.lhs.TypeExpr() }
 func (n *Field) DefaultValue() *Expr { return n.rhs.Expr() }
 
-func NewField(name t.ID, xType *TypeExpr, defaultValue *Expr) *Field {
+func NewField(flags Flags, name t.ID, xType *TypeExpr, defaultValue *Expr) *Field {
 	return &Field{
-		kind: KField,
-		id2:  name,
-		lhs:  xType.Node(),
-		rhs:  defaultValue.Node(),
+		kind:  KField,
+		flags: flags,
+		id2:   name,
+		lhs:   xType.Node(),
+		rhs:   defaultValue.Node(),
 	}
 }
 
@@ -629,6 +657,7 @@ const MaxTypeExprDepth = 63
 //  - LHS:   <nil|Expr>
 //  - MHS:   <nil|Expr>
 //  - RHS:   <nil|TypeExpr>
+//  - List0: <TypeExpr> type arguments
 //
 // An IDPtr ID0 means "ptr RHS". RHS is the inner type.
 //
@@ -648,6 +677,9 @@ const MaxTypeExprDepth = 63
 // Numeric types can be refined as "foo[LHS..MHS]". LHS and MHS are Expr's,
 // possibly nil. For example, the LHS for "u32[..4095]" is nil.
 //
+// Generic struct types are instantiated as "foo[List0]", such as
+// "ring_buffer[u8]". Such a type is never refined.
+//
 // TODO: struct types, list types, nptr vs ptr.
 type TypeExpr Node
 
@@ -661,6 +693,7 @@ func (n *TypeExpr) Bounds() [2]*Expr    { return [2]*Expr{n.lhs.Expr(), n.mhs.Ex
 func (n *TypeExpr) Min() *Expr          { return n.lhs.Expr() }
 func (n *TypeExpr) Max() *Expr          { return n.mhs.Expr() }
 func (n *TypeExpr) Inner() *TypeExpr    { return n.rhs.TypeExpr() }
+func (n *TypeExpr) TypeArgs() []*Node   { return n.list0 }
 
 func (n *TypeExpr) Innermost() *TypeExpr {
 	for ; n != nil && n.Inner() != nil; n = n.Inner() {
@@ -740,6 +773,17 @@ func NewTypeExpr(decorator t.ID, pkg t.ID, name t.ID, alenRecvMin *Node, max *Ex
 	}
 }
 
+// NewGenericTypeExpr returns the "pkg.name[typeArgs]" instantiation of a
+// generic struct type.
+func NewGenericTypeExpr(pkg t.ID, name t.ID, typeArgs []*Node) *TypeExpr {
+	return &TypeExpr{
+		kind:  KTypeExpr,
+		id1:   pkg,
+		id2:   name,
+		list0: typeArgs,
+	}
+}
+
 // MaxBodyDepth is an advisory limit for a function body's recursion depth.
 const MaxBodyDepth = 255
 
@@ -752,6 +796,7 @@ const MaxBodyDepth = 255
 //  - ID2:   <0|receiverName>
 //  - LHS:   <Struct> in-parameters
 //  - RHS:   <Struct> out-parameters
+//  - List0: <TypeParam> type parameters
 //  - List1: <Assert> asserts
 //  - List2: <Statement> function body
 //
@@ -767,23 +812,24 @@ const MaxBodyDepth = 255
 //  - While
 type Func Node
 
-func (n *Func) Node() *Node       { return (*Node)(n) }
-func (n *Func) Effect() Effect    { return Effect(n.flags & flagEffect) }
-func (n *Func) Pure() bool        { return n.flags&FlagsImpure == 0 }
-func (n *Func) Impure() bool      { return n.flags&FlagsImpure != 0 }
-func (n *Func) Suspendible() bool { return n.flags&FlagsSuspendible != 0 }
-func (n *Func) Public() bool      { return n.flags&FlagsPublic != 0 }
-func (n *Func) Filename() string  { return n.filename }
-func (n *Func) Line() uint32      { return n.line }
-func (n *Func) QQID() t.QQID      { return t.QQID{n.id1, n.id2, n.id0} }
-func (n *Func) Receiver() t.QID   { return t.QID{n.id1, n.id2} }
-func (n *Func) FuncName() t.ID    { return n.id0 }
-func (n *Func) In() *Struct       { return n.lhs.Struct() }
-func (n *Func) Out() *Struct      { return n.rhs.Struct() }
-func (n *Func) Asserts() []*Node  { return n.list1 }
-func (n *Func) Body() []*Node     { return n.list2 }
-
-func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, out *Struct, asserts []*Node, body []*Node) *Func {
+func (n *Func) Node() *Node         { return (*Node)(n) }
+func (n *Func) Effect() Effect      { return Effect(n.flags & flagEffect) }
+func (n *Func) Pure() bool          { return n.flags&FlagsImpure == 0 }
+func (n *Func) Impure() bool        { return n.flags&FlagsImpure != 0 }
+func (n *Func) Suspendible() bool   { return n.flags&FlagsSuspendible != 0 }
+func (n *Func) Public() bool        { return n.flags&FlagsPublic != 0 }
+func (n *Func) Filename() string    { return n.filename }
+func (n *Func) Line() uint32        { return n.line }
+func (n *Func) QQID() t.QQID        { return t.QQID{n.id1, n.id2, n.id0} }
+func (n *Func) Receiver() t.QID     { return t.QID{n.id1, n.id2} }
+func (n *Func) FuncName() t.ID      { return n.id0 }
+func (n *Func) In() *Struct         { return n.lhs.Struct() }
+func (n *Func) Out() *Struct        { return n.rhs.Struct() }
+func (n *Func) TypeParams() []*Node { return n.list0 }
+func (n *Func) Asserts() []*Node    { return n.list1 }
+func (n *Func) Body() []*Node       { return n.list2 }
+
+func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, typeParams []*Node, in *Struct, out *Struct, asserts []*Node, body []*Node) *Func {
 	return &Func{
 		kind:     KFunc,
 		flags:    flags,
@@ -793,6 +839,7 @@ func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcN
 		id2:      receiverName,
 		lhs:      in.Node(),
 		rhs:      out.Node(),
+		list0:    typeParams,
 		list1:    asserts,
 		list2:    body,
 	}
@@ -851,23 +898,25 @@ func NewConst(flags Flags, filename string, line uint32, name t.ID, xType *TypeE
 	}
 }
 
-// Struct is "struct ID2(List0)":
+// Struct is "struct ID2[List1](List0)":
 //  - FlagsSuspendible is "ID1" vs "ID1?"
 //  - FlagsPublic      is "pub" vs "pri"
 //  - ID1:   <0|pkg> (set by calling SetPackage)
 //  - ID2:   name
 //  - List0: <Field> fields
+//  - List1: <TypeParam> type parameters
 type Struct Node
 
-func (n *Struct) Node() *Node       { return (*Node)(n) }
-func (n *Struct) Suspendible() bool { return n.flags&FlagsSuspendible != 0 }
-func (n *Struct) Public() bool      { return n.flags&FlagsPublic != 0 }
-func (n *Struct) Filename() string  { return n.filename }
-func (n *Struct) Line() uint32      { return n.line }
-func (n *Struct) QID() t.QID        { return t.QID{n.id1, n.id2} }
-func (n *Struct) Fields() []*Node   { return n.list0 }
+func (n *Struct) Node() *Node         { return (*Node)(n) }
+func (n *Struct) Suspendible() bool   { return n.flags&FlagsSuspendible != 0 }
+func (n *Struct) Public() bool        { return n.flags&FlagsPublic != 0 }
+func (n *Struct) Filename() string    { return n.filename }
+func (n *Struct) Line() uint32        { return n.line }
+func (n *Struct) QID() t.QID          { return t.QID{n.id1, n.id2} }
+func (n *Struct) Fields() []*Node     { return n.list0 }
+func (n *Struct) TypeParams() []*Node { return n.list1 }
 
-func NewStruct(flags Flags, filename string, line uint32, name t.ID, fields []*Node) *Struct {
+func NewStruct(flags Flags, filename string, line uint32, name t.ID, typeParams []*Node, fields []*Node) *Struct {
 	return &Struct{
 		kind:     KStruct,
 		flags:    flags,
@@ -875,6 +924,25 @@ func NewStruct(flags Flags, filename string, line uint32, name t.ID, fields []*N
 		line:     line,
 		id2:      name,
 		list0:    fields,
+		list1:    typeParams,
+	}
+}
+
+// TypeParam is a type parameter, such as the "T" in "struct foo[T](x T)", or
+// "ID2: ID1" if it is constrained, such as "T: numeric":
+//  - ID1:   <0|numeric|ptr|struct> constraint
+//  - ID2:   name
+type TypeParam Node
+
+func (n *TypeParam) Node() *Node      { return (*Node)(n) }
+func (n *TypeParam) Constraint() t.ID { return n.id1 }
+func (n *TypeParam) Name() t.ID       { return n.id2 }
+
+func NewTypeParam(constraint t.ID, name t.ID) *TypeParam {
+	return &TypeParam{
+		kind: KTypeParam,
+		id1:  constraint,
+		id2:  name,
 	}
 }
 
@@ -896,20 +964,23 @@ func NewPackageID(filename string, line uint32, id t.ID) *PackageID {
 	}
 }
 
-// Use is "use ID2":
+// Use is "use ID2" or "use ID2 as ID1":
+//  - ID1:   <0|ident> package alias
 //  - ID2:   <string literal> package path
 type Use Node
 
 func (n *Use) Node() *Node      { return (*Node)(n) }
 func (n *Use) Filename() string { return n.filename }
 func (n *Use) Line() uint32     { return n.line }
+func (n *Use) Alias() t.ID      { return n.id1 }
 func (n *Use) Path() t.ID       { return n.id2 }
 
-func NewUse(filename string, line uint32, path t.ID) *Use {
+func NewUse(filename string, line uint32, path t.ID, alias t.ID) *Use {
 	return &Use{
 		kind:     KUse,
 		filename: filename,
 		line:     line,
+		id1:      alias,
 		id2:      path,
 	}
 }
@@ -922,6 +993,8 @@ func (n *File) Node() *Node            { return (*Node)(n) }
 func (n *File) Filename() string       { return n.filename }
 func (n *File) TopLevelDecls() []*Node { return n.list0 }
 
+func (n *File) SetTopLevelDecls(x []*Node) { n.list0 = x }
+
 func NewFile(filename string, topLevelDecls []*Node) *File {
 	return &File{
 		kind:     KFile,
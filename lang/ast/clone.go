@@ -0,0 +1,51 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+// Clone returns a deep copy of n, so that the copy can be type checked, or
+// otherwise modified, without modifying n. n's type expressions, such as the
+// "u32" in "x as u32", are shared instead of copied, as they are not specific
+// to where an expression is used.
+func (n *Expr) Clone() *Expr {
+	if n == nil {
+		return nil
+	}
+	return n.Node().clone().Expr()
+}
+
+func (n *Node) clone() *Node {
+	if n == nil || n.kind == KTypeExpr {
+		return n
+	}
+	o := *n
+	o.lhs = n.lhs.clone()
+	o.mhs = n.mhs.clone()
+	o.rhs = n.rhs.clone()
+	o.list0 = cloneList(n.list0)
+	o.list1 = cloneList(n.list1)
+	o.list2 = cloneList(n.list2)
+	return &o
+}
+
+func cloneList(l []*Node) []*Node {
+	if l == nil {
+		return nil
+	}
+	ret := make([]*Node, len(l))
+	for i, o := range l {
+		ret[i] = o.clone()
+	}
+	return ret
+}
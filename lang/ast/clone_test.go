@@ -0,0 +1,74 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestClone(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []string{
+		"1",
+		"x + 1",
+		"this.g(k:K[x], j:(y as u32))",
+		"in.src.read_u8?() + 3",
+	}
+
+	for _, src := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+		if err != nil {
+			tt.Errorf("Tokenize(%q): %v", src, err)
+			continue
+		}
+		n, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Errorf("ParseExpr(%q): %v", src, err)
+			continue
+		}
+		c := n.Clone()
+		if got, want := c.Str(tm), n.Str(tm); got != want {
+			tt.Errorf("%q: Clone: got %q, want %q", src, got, want)
+		}
+		if !c.Eq(n) {
+			tt.Errorf("%q: Clone: got a non-equal expression", src)
+		}
+
+		// Modifying the clone must not modify n.
+		shared := map[*a.Node]bool{}
+		n.Node().Walk(func(o *a.Node) error {
+			if o.Kind() != a.KTypeExpr {
+				shared[o] = true
+			}
+			return nil
+		})
+		c.Node().Walk(func(o *a.Node) error {
+			if shared[o] {
+				tt.Errorf("%q: Clone: node %q is shared", src, o.Expr().Str(tm))
+			}
+			o.SetTypeChecked()
+			return nil
+		})
+		if n.Node().TypeChecked() {
+			tt.Errorf("%q: Clone: the original was modified", src)
+		}
+	}
+}
@@ -46,7 +46,7 @@ func (n *Expr) Eq(o *Expr) bool {
 		return false
 	}
 
-	if n.id0.Key() == t.KeyXBinaryAs {
+	if k := n.id0.Key(); k == t.KeyXBinaryAs || k == t.KeySizeof {
 		if !n.rhs.TypeExpr().Eq(o.rhs.TypeExpr()) {
 			return false
 		}
@@ -72,7 +72,7 @@ func (n *Expr) Mentions(o *Expr) bool {
 	if n.Eq(o) ||
 		n.lhs.Expr().Mentions(o) ||
 		n.mhs.Expr().Mentions(o) ||
-		(n.id0.Key() != t.KeyXBinaryAs && n.rhs.Expr().Mentions(o)) {
+		(n.id0.Key() != t.KeyXBinaryAs && n.id0.Key() != t.KeySizeof && n.rhs.Expr().Mentions(o)) {
 		return true
 	}
 	for _, x := range n.list0 {
@@ -110,6 +110,14 @@ func (n *TypeExpr) eq(o *TypeExpr, ignoreRefinements bool) bool {
 				return false
 			}
 		}
+		if len(n.list0) != len(o.list0) {
+			return false
+		}
+		for i := range n.list0 {
+			if !n.list0[i].TypeExpr().eq(o.list0[i].TypeExpr(), false) {
+				return false
+			}
+		}
 		if n.rhs == nil && o.rhs == nil {
 			return true
 		}
@@ -117,3 +125,44 @@ func (n *TypeExpr) eq(o *TypeExpr, ignoreRefinements bool) bool {
 		o = o.rhs.TypeExpr()
 	}
 }
+
+// SignaturesCompatible returns whether n and o have compatible signatures: the
+// same effect (pure, impure or suspendible) and the same number of type
+// parameters, in-params and out-params, with each param's type equal to the
+// other function's param in the same position, ignoring refinements such as
+// the "[i..j]" in "u32[i..j]". Param names and the receiver are ignored.
+func SignaturesCompatible(n *Func, o *Func) bool {
+	return signaturesEq(n, o, true)
+}
+
+// SignaturesEq is like SignaturesCompatible except that refinements have to
+// be equal too.
+func SignaturesEq(n *Func, o *Func) bool {
+	return signaturesEq(n, o, false)
+}
+
+func signaturesEq(n *Func, o *Func, ignoreRefinements bool) bool {
+	if n == o {
+		return true
+	}
+	if n == nil || o == nil {
+		return false
+	}
+	if n.Effect() != o.Effect() || len(n.TypeParams()) != len(o.TypeParams()) {
+		return false
+	}
+	return fieldTypesEq(n.In().Fields(), o.In().Fields(), ignoreRefinements) &&
+		fieldTypesEq(n.Out().Fields(), o.Out().Fields(), ignoreRefinements)
+}
+
+func fieldTypesEq(n []*Node, o []*Node, ignoreRefinements bool) bool {
+	if len(n) != len(o) {
+		return false
+	}
+	for i := range n {
+		if !n[i].Field().XType().eq(o[i].Field().XType(), ignoreRefinements) {
+			return false
+		}
+	}
+	return true
+}
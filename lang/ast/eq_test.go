@@ -0,0 +1,73 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestSignaturesCompatible(tt *testing.T) {
+	const filename = "test.wuffs"
+	const base = "pri func s.f(x u32, y u8[..9])(z u64)"
+	testCases := []struct {
+		src            string
+		wantCompatible bool
+		wantEq         bool
+	}{
+		{"pri func s.f(x u32, y u8[..9])(z u64)", true, true},
+		{"pri func t.g(a u32, b u8[..9])(c u64)", true, true},
+		{"pri func s.f(x u32, y u8)(z u64)", true, false},
+		{"pri func s.f(x u32[1..], y u8[..9])(z u64[..5])", true, false},
+		{"pri func s.f(x u32, y u8[..9])(z u32)", false, false},
+		{"pri func s.f(y u8[..9], x u32)(z u64)", false, false},
+		{"pri func s.f(x u32)(z u64)", false, false},
+		{"pri func s.f(x u32, y u8[..9])()", false, false},
+		{"pri func s.f!(x u32, y u8[..9])(z u64)", false, false},
+		{"pri func s.f?(x u32, y u8[..9])(z u64)", false, false},
+		{"pri func s.f(x ptr u32, y u8[..9])(z u64)", false, false},
+		{"pri func s.f(x[4] u32, y u8[..9])(z u64)", false, false},
+	}
+
+	parseFunc := func(tm *t.Map, src string) *a.Func {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(src+" {\n}\n"))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", src, err)
+		}
+		f, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("Parse(%q): %v", src, err)
+		}
+		return f.TopLevelDecls()[0].Func()
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		b, f := parseFunc(tm, base), parseFunc(tm, tc.src)
+		if got := a.SignaturesCompatible(b, f); got != tc.wantCompatible {
+			tt.Errorf("%q: SignaturesCompatible: got %t, want %t", tc.src, got, tc.wantCompatible)
+		}
+		if got := a.SignaturesCompatible(f, b); got != tc.wantCompatible {
+			tt.Errorf("%q: SignaturesCompatible (reversed): got %t, want %t", tc.src, got, tc.wantCompatible)
+		}
+		if got := a.SignaturesEq(b, f); got != tc.wantEq {
+			tt.Errorf("%q: SignaturesEq: got %t, want %t", tc.src, got, tc.wantEq)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Flatten returns a canonical form of n, where nested uses of the same
+// associative operator are merged into a single node. For example, "(a + b) +
+// c", "a + (b + c)" and "a + b + c" all flatten to the same associative "a + b
+// + c" node. An operator with exactly two operands is in binary form and one
+// with three or more is in associative form.
+//
+// n itself is not modified. Sub-expressions are copied where necessary, and
+// the copies keep their original MType and ConstValue.
+func Flatten(n *Expr) *Expr {
+	if n == nil {
+		return nil
+	}
+	o := *n
+	o.lhs = flattenNode(n.lhs)
+	o.mhs = flattenNode(n.mhs)
+	if k := n.id0.Key(); k != t.KeyXBinaryAs && k != t.KeySizeof {
+		o.rhs = flattenNode(n.rhs)
+	}
+	if n.list0 != nil {
+		o.list0 = make([]*Node, len(n.list0))
+		for i, x := range n.list0 {
+			o.list0[i] = flattenNode(x)
+		}
+	}
+
+	op := associativeForm(n.id0)
+	if op == 0 {
+		return &o
+	}
+	operands := o.list0
+	if n.id0.IsXBinaryOp() {
+		operands = []*Node{o.lhs, o.rhs}
+	}
+	flat := make([]*Node, 0, len(operands))
+	for _, x := range operands {
+		if x.kind == KExpr && associativeForm(x.id0) == op {
+			if x.id0.IsXBinaryOp() {
+				flat = append(flat, x.lhs, x.rhs)
+			} else {
+				flat = append(flat, x.list0...)
+			}
+		} else {
+			flat = append(flat, x)
+		}
+	}
+
+	if len(flat) == 2 {
+		o.id0 = op.AmbiguousForm().BinaryForm()
+		o.lhs, o.rhs, o.list0 = flat[0], flat[1], nil
+	} else {
+		o.id0 = op
+		o.lhs, o.rhs, o.list0 = nil, nil, flat
+	}
+	return &o
+}
+
+func flattenNode(n *Node) *Node {
+	if n == nil {
+		return nil
+	}
+	switch n.kind {
+	case KExpr:
+		return Flatten(n.Expr()).Node()
+	case KArg:
+		o := *n
+		o.rhs = flattenNode(n.rhs)
+		return &o
+	}
+	return n
+}
+
+// associativeForm returns the associative form of the binary or associative
+// operator op, or zero if op has no associative form.
+func associativeForm(op t.ID) t.ID {
+	if op.IsXAssociativeOp() {
+		return op
+	}
+	if op.IsXBinaryOp() {
+		return op.AmbiguousForm().AssociativeForm()
+	}
+	return 0
+}
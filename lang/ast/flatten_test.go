@@ -0,0 +1,76 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestFlatten(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := [][2]string{
+		{"x", "x"},
+		{"x + y", "x + y"},
+		{"x + y + z", "x + y + z"},
+		{"(x + y) + z", "x + y + z"},
+		{"x + (y + z)", "x + y + z"},
+		{"(w + x) + (y + z)", "w + x + y + z"},
+		{"(x * y) + z", "(x * y) + z"},
+		{"(x - y) - z", "(x - y) - z"},
+		{"x and (y and z)", "x and y and z"},
+		{"-((x | y) | z)", "-(x | y | z)"},
+		{"f(a:(x + y) + z)[(i + j) + k]", "f(a:x + y + z)[i + j + k]"},
+		{"((x + y) + z) as u32", "(x + y + z) as u32"},
+	}
+
+	tm := &t.Map{}
+	parseExpr := func(s string) *a.Expr {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(s))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", s, err)
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("ParseExpr(%q): %v", s, err)
+		}
+		return expr
+	}
+
+	for _, tc := range testCases {
+		expr := parseExpr(tc[0])
+		before := expr.Str(tm)
+		flat := a.Flatten(expr)
+		if got, want := flat.Str(tm), tc[1]; got != want {
+			tt.Errorf("%q: got %q, want %q", tc[0], got, want)
+		}
+		if err := a.ValidateOperatorForms(flat.Node()); err != nil {
+			tt.Errorf("%q: %v", tc[0], err)
+		}
+		if got := expr.Str(tm); got != before {
+			tt.Errorf("%q: input was modified: got %q, want %q", tc[0], got, before)
+		}
+	}
+
+	lhs := a.Flatten(parseExpr("(x + y) + z"))
+	rhs := a.Flatten(parseExpr("x + (y + z)"))
+	if !lhs.Eq(rhs) {
+		tt.Errorf("(x + y) + z and x + (y + z): got not Eq, want Eq")
+	}
+}
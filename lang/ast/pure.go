@@ -0,0 +1,92 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"errors"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+var (
+	errNotMovable = errors.New("ast: not movable")
+	errNotPure    = errors.New("ast: not pure")
+)
+
+// IsPure returns whether evaluating n has no side effects and does not read
+// the state of a buffer, such as a reader1 or writer1, whose contents or
+// position can change without n's sub-expressions changing. Evaluating a pure
+// expression twice, with no intervening assignments, gives the same value.
+//
+// n should already be type checked: a call's receiver type, set by the
+// checker, is how buffer method calls such as "in.src.available()" are
+// recognized. An unchecked call is conservatively assumed to be impure.
+func (n *Expr) IsPure() bool {
+	return n.Node().Walk(func(o *Node) error {
+		if o.kind != KExpr {
+			return nil
+		}
+		if o.flags&FlagsImpure != 0 {
+			return errNotPure
+		}
+		if o.id0.Key() != t.KeyOpenParen {
+			return nil
+		}
+		f := o.lhs.Expr()
+		if f.id0.Key() != t.KeyDot {
+			return nil
+		}
+		if recv := f.lhs.Expr().mType; recv == nil || recv.Pointee().isBufferType() {
+			return errNotPure
+		}
+		return nil
+	}) == nil
+}
+
+// IsMovable returns whether n is pure and its value does not depend on any
+// storage that can change over a function's execution, so that n can be
+// evaluated earlier or later, for example hoisted out of a loop, without
+// changing its value.
+//
+// This is conservative. Literals and package-level constants are movable, as
+// are pure operators, indexes, selectors and calls applied to movable
+// operands. Any other identifier, such as a local variable, "in", "out" or
+// "this", is not, even if nothing assigns to it between two points: proving
+// that needs the enclosing function, not just n.
+func (n *Expr) IsMovable() bool {
+	if !n.IsPure() {
+		return false
+	}
+	return n.Node().Walk(func(o *Node) error {
+		if o.kind != KExpr || o.id0 != 0 {
+			return nil
+		}
+		if o.constValue == nil && !o.id2.IsLiteral() && o.flags&FlagsGlobalIdent == 0 {
+			return errNotMovable
+		}
+		return nil
+	}) == nil
+}
+
+func (n *TypeExpr) isBufferType() bool {
+	if n.id0 != 0 {
+		return false
+	}
+	switch n.id2.Key() {
+	case t.KeyBuf1, t.KeyReader1, t.KeyWriter1, t.KeyBuf2:
+		return true
+	}
+	return false
+}
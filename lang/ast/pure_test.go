@@ -0,0 +1,113 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestIsPureIsMovable(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		src         string
+		wantPure    bool
+		wantMovable bool
+	}{
+		{"1", true, true},
+		{"1 + 2 * 3", true, true},
+		{"K", true, true},
+		{"K + 1", true, true},
+		{"K[2]", true, true},
+		{"K.low_bits(n:3)", true, true},
+		{"(K as u32) << 4", true, true},
+		{"x", true, false},
+		{"x + 1", true, false},
+		{"K[x]", true, false},
+		{"this.f", true, false},
+		{"in.x", true, false},
+		{"x.low_bits(n:3)", true, false},
+		{"this.g(k:K)", true, false},
+		{"this.g!(k:K)", false, false},
+		{"1 + this.g!(k:K)", false, false},
+		{"in.src.read_u8?()", false, false},
+		{"in.src.available()", false, false},
+		{"out.dst.available() > 0", false, false},
+		{"in.src.since_mark()", false, false},
+		{"unchecked.h()", false, false},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(tc.src))
+		if err != nil {
+			tt.Errorf("Tokenize(%q): %v", tc.src, err)
+			continue
+		}
+		n, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Errorf("ParseExpr(%q): %v", tc.src, err)
+			continue
+		}
+		if err := fakeTypeCheck(tm, n); err != nil {
+			tt.Errorf("fakeTypeCheck(%q): %v", tc.src, err)
+			continue
+		}
+		if got := n.IsPure(); got != tc.wantPure {
+			tt.Errorf("%q: IsPure: got %t, want %t", tc.src, got, tc.wantPure)
+		}
+		if got := n.IsMovable(); got != tc.wantMovable {
+			tt.Errorf("%q: IsMovable: got %t, want %t", tc.src, got, tc.wantMovable)
+		}
+	}
+}
+
+// fakeTypeCheck sets just enough of what the checker would set for IsPure and
+// IsMovable: "K" is a package-level constant, and every method call's
+// receiver has a type, other than that of "unchecked".
+func fakeTypeCheck(tm *t.Map, n *a.Expr) error {
+	recvTypes := map[string]string{
+		"K":       "u32",
+		"x":       "u32",
+		"this":    "foo",
+		"in.src":  "reader1",
+		"out.dst": "writer1",
+	}
+	return n.Node().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.Expr()
+		if x.Operator() == 0 && x.Ident().Str(tm) == "K" {
+			x.SetGlobalIdent()
+		}
+		if x.Operator().Key() != t.KeyOpenParen {
+			return nil
+		}
+		recv := x.LHS().Expr().LHS().Expr()
+		if s, ok := recvTypes[recv.Str(tm)]; ok {
+			name, err := tm.Insert(s)
+			if err != nil {
+				return err
+			}
+			recv.SetMType(a.NewTypeExpr(0, 0, name, nil, nil, nil))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"sort"
+)
+
+// ExprSpan pairs an expression with its source span.
+//
+// Expressions only record their first token's line, not its column, so the
+// span covers whole lines, from Line to EndLine inclusive. EndLine is the
+// last line on which any of the expression's sub-expressions starts, so a
+// trailing ")" or "]" on a later line is not part of the span. A Line of zero
+// means that the expression was not parsed from source.
+type ExprSpan struct {
+	Expr     *Expr
+	Filename string
+	Line     uint32
+	EndLine  uint32
+}
+
+// Contains returns whether the span contains the given source line.
+func (s ExprSpan) Contains(filename string, line uint32) bool {
+	return s.Line != 0 && s.Filename == filename && s.Line <= line && line <= s.EndLine
+}
+
+// SubExprsWithSpans returns n and all of its sub-expressions, each paired with
+// its span. Type expressions, such as the "u32" in "x as u32", are skipped.
+//
+// The list is ordered by the number of lines spanned, smallest first, and for
+// equal spans, a sub-expression comes before the expressions that contain it.
+// The first element that Contains a cursor's line is therefore the innermost
+// expression at that cursor, to line granularity.
+func (n *Expr) SubExprsWithSpans() []ExprSpan {
+	if n == nil {
+		return nil
+	}
+	ret := []ExprSpan(nil)
+	n.Node().subExprSpans(&ret)
+	sort.SliceStable(ret, func(i int, j int) bool {
+		return ret[i].EndLine-ret[i].Line < ret[j].EndLine-ret[j].Line
+	})
+	return ret
+}
+
+// subExprSpans appends the spans of n's expressions to ret, children before
+// parents, and returns n's own span.
+func (n *Node) subExprSpans(ret *[]ExprSpan) (filename string, line uint32, endLine uint32) {
+	if n == nil || n.kind == KTypeExpr {
+		return "", 0, 0
+	}
+	filename, line, endLine = n.filename, n.line, n.line
+	merge := func(f string, l uint32, e uint32) {
+		if l == 0 {
+			return
+		}
+		if line == 0 || l < line {
+			filename, line = f, l
+		}
+		if endLine < e {
+			endLine = e
+		}
+	}
+	for _, o := range n.Raw().SubNodes() {
+		merge(o.subExprSpans(ret))
+	}
+	for _, l := range n.Raw().SubLists() {
+		for _, o := range l {
+			merge(o.subExprSpans(ret))
+		}
+	}
+	if n.kind == KExpr {
+		*ret = append(*ret, ExprSpan{
+			Expr:     n.Expr(),
+			Filename: filename,
+			Line:     line,
+			EndLine:  endLine,
+		})
+	}
+	return filename, line, endLine
+}
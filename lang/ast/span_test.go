@@ -0,0 +1,81 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestSubExprsWithSpans(tt *testing.T) {
+	const filename = "test.wuffs"
+	const src = "" +
+		"this.g(a:x,\n" +
+		"  b:(y + 2) *\n" +
+		"  z) + (w as u32)"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	n, err := parse.ParseExpr(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("ParseExpr: %v", err)
+	}
+
+	got := []string(nil)
+	for _, s := range n.SubExprsWithSpans() {
+		if s.Filename != filename {
+			tt.Errorf("%q: Filename: got %q, want %q", s.Expr.Str(tm), s.Filename, filename)
+		}
+		got = append(got, fmt.Sprintf("%d-%d %s", s.Line, s.EndLine, s.Expr.Str(tm)))
+	}
+	want := []string{
+		"1-1 this",
+		"1-1 this.g",
+		"1-1 x",
+		"2-2 y",
+		"2-2 2",
+		"2-2 y + 2",
+		"3-3 z",
+		"3-3 w",
+		"3-3 w as u32",
+		"2-3 (y + 2) * z",
+		"1-3 this.g(a:x, b:(y + 2) * z)",
+		"1-3 this.g(a:x, b:(y + 2) * z) + (w as u32)",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		tt.Fatalf("\ngot:\n%s\nwant:\n%s", g, w)
+	}
+
+	// The innermost expression on line 2 is the first one to contain it.
+	for _, s := range n.SubExprsWithSpans() {
+		if s.Contains(filename, 2) {
+			if got, want := s.Expr.Str(tm), "y"; got != want {
+				tt.Errorf("innermost on line 2: got %q, want %q", got, want)
+			}
+			break
+		}
+	}
+	if s := n.SubExprsWithSpans()[0]; s.Contains("other.wuffs", 1) {
+		tt.Errorf("Contains: got true for a different filename")
+	}
+}
@@ -107,6 +107,11 @@ func (n *Expr) appendStr(buf []byte, tm *t.Map, parenthesize bool, depth uint32)
 					buf = o.Expr().appendStr(buf, tm, false, depth)
 				}
 				buf = append(buf, ')')
+
+			case t.KeySizeof:
+				buf = append(buf, "sizeof("...)
+				buf = append(buf, n.rhs.TypeExpr().Str(tm)...)
+				buf = append(buf, ')')
 			}
 
 		case t.FlagsUnaryOp:
@@ -190,7 +195,7 @@ func (n *TypeExpr) Str(tm *t.Map) string {
 	if n == nil {
 		return ""
 	}
-	if n.Decorator() == 0 && n.Min() == nil && n.Max() == nil {
+	if n.Decorator() == 0 && n.Min() == nil && n.Max() == nil && len(n.TypeArgs()) == 0 {
 		return n.QID().Str(tm)
 	}
 	return string(n.appendStr(nil, tm, 0))
@@ -208,6 +213,16 @@ func (n *TypeExpr) appendStr(buf []byte, tm *t.Map, depth uint32) []byte {
 	switch n.Decorator().Key() {
 	case 0:
 		buf = append(buf, n.QID().Str(tm)...)
+		if args := n.TypeArgs(); len(args) > 0 {
+			buf = append(buf, '[')
+			for i, o := range args {
+				if i > 0 {
+					buf = append(buf, ", "...)
+				}
+				buf = o.TypeExpr().appendStr(buf, tm, depth)
+			}
+			buf = append(buf, ']')
+		}
 	case t.KeyPtr:
 		buf = append(buf, "ptr "...)
 		return n.Inner().appendStr(buf, tm, depth)
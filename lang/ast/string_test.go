@@ -53,6 +53,8 @@ func TestString(tt *testing.T) {
 		"x + 42",
 		"x and (y < z)",
 		"x & (y as u8)",
+		"sizeof(u32)",
+		"sizeof([4] foo) * 2",
 		"x * ((a / b) - (i / j))",
 
 		"x + y + z",
@@ -0,0 +1,71 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"fmt"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+const opFlags = t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp
+
+// ValidateOperatorForms checks that every operator Expr node under n has its
+// ID0 in disambiguous form (e.g. IDXBinaryPlus, not a bare IDPlus), and that
+// the node's shape matches that form's arity:
+//  - unary operators have a RHS and no LHS, MHS or List0.
+//  - binary operators have a LHS and RHS, and no MHS or List0.
+//  - associative operators have at least two List0 elements and no LHS, MHS
+//    or RHS.
+//
+// The parser should always produce valid nodes, but programmatically
+// constructed nodes may not be.
+func ValidateOperatorForms(n *Node) error {
+	return n.Walk(func(o *Node) error {
+		if o.kind != KExpr {
+			return nil
+		}
+		op := o.id0
+		flags := op.Flags() & opFlags
+		if flags == 0 {
+			return nil
+		}
+		if !op.IsXUnaryOp() && !op.IsXBinaryOp() && !op.IsXAssociativeOp() {
+			return fmt.Errorf("ast: operator token.Key 0x%02X is not in disambiguous form", op.Key())
+		}
+
+		switch flags {
+		case t.FlagsUnaryOp:
+			if o.lhs != nil || o.mhs != nil || o.rhs == nil || len(o.list0) != 0 {
+				return fmt.Errorf("ast: unary operator token.Key 0x%02X does not have exactly one operand",
+					op.Key())
+			}
+		case t.FlagsBinaryOp:
+			if o.lhs == nil || o.mhs != nil || o.rhs == nil || len(o.list0) != 0 {
+				return fmt.Errorf("ast: binary operator token.Key 0x%02X does not have exactly two operands",
+					op.Key())
+			}
+		case t.FlagsAssociativeOp:
+			if o.lhs != nil || o.mhs != nil || o.rhs != nil || len(o.list0) < 2 {
+				return fmt.Errorf("ast: associative operator token.Key 0x%02X does not have two or more operands",
+					op.Key())
+			}
+		default:
+			return fmt.Errorf("ast: operator token.Key 0x%02X has inconsistent flags 0x%04X",
+				op.Key(), flags)
+		}
+		return nil
+	})
+}
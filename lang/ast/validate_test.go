@@ -0,0 +1,73 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestValidateOperatorForms(tt *testing.T) {
+	const filename = "test.wuffs"
+	tm := &t.Map{}
+	for _, tc := range []string{
+		"x",
+		"-x",
+		"x + y",
+		"x + y + z",
+		"f(a:i + j)[k:-l].m",
+		"x as u32",
+	} {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(tc))
+		if err != nil {
+			tt.Errorf("Tokenize(%q): %v", tc, err)
+			continue
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Errorf("ParseExpr(%q): %v", tc, err)
+			continue
+		}
+		if err := a.ValidateOperatorForms(expr.Node()); err != nil {
+			tt.Errorf("%q: %v", tc, err)
+		}
+	}
+
+	x, err := tm.Insert("x")
+	if err != nil {
+		tt.Fatalf("Insert: %v", err)
+	}
+	xe := func() *a.Node { return a.NewExpr(0, 0, 0, x, nil, nil, nil, nil).Node() }
+
+	bad := map[string]*a.Expr{
+		"ambiguous plus": a.NewExpr(0, t.IDPlus, 0, 0, xe(), nil, xe(), nil),
+		"unary with lhs": a.NewExpr(0, t.IDXUnaryMinus, 0, 0, xe(), nil, xe(), nil),
+		"binary no rhs":  a.NewExpr(0, t.IDXBinaryPlus, 0, 0, xe(), nil, nil, nil),
+		"assoc one arg":  a.NewExpr(0, t.IDXAssociativePlus, 0, 0, nil, nil, nil, []*a.Node{xe()}),
+		"unary and binary": a.NewExpr(0, t.IDXBinaryPlus|t.ID(t.FlagsUnaryOp), 0, 0,
+			xe(), nil, xe(), nil),
+		"nested": a.NewExpr(0, t.IDXUnaryMinus, 0, 0, nil, nil,
+			a.NewExpr(0, t.IDXBinaryStar, 0, 0, nil, nil, xe(), nil).Node(), nil),
+	}
+	for name, n := range bad {
+		if err := a.ValidateOperatorForms(n.Node()); err == nil {
+			tt.Errorf("%s: got nil error, want non-nil", name)
+		}
+	}
+}
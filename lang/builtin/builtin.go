@@ -16,6 +16,7 @@
 package builtin
 
 import (
+	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
 
@@ -50,6 +51,7 @@ var StatusList = [...]Status{
 	{t.IDError, "cannot return a suspension"},
 	{t.IDError, "invalid call sequence"},
 	{t.IDSuspension, "end of data"},
+	{t.IDError, "failed assumption"}, // Used if an assume_in_bounds run time check fails.
 }
 
 var StatusMap = map[string]Status{}
@@ -77,8 +79,6 @@ var Types = []string{
 }
 
 var Funcs = []string{
-	// TODO: some methods like "mark" should probably have a trailing "!".
-	//
 	// TODO: [] u8 methods (length, etc).
 
 	"u8.high_bits(n u32)(ret u8)",
@@ -105,7 +105,7 @@ var Funcs = []string{
 	"reader1.available()(ret u64)",
 	"reader1.is_marked()(ret bool)",
 	"reader1.limit(l u64)(ret reader1)",
-	"reader1.mark()()",
+	"reader1.mark!()()",
 	"reader1.since_mark()(ret[] u8)",
 	"reader1.skip32?(n u32)()",
 	"reader1.skip64?(n u64)()",
@@ -120,13 +120,13 @@ var Funcs = []string{
 	"writer1.write_u64le?(x u64)()",
 
 	"writer1.available()(ret u64)",
-	"writer1.copy_from_history32(distance u32, length u32)(ret u32)",
-	"writer1.copy_from_reader32(r reader1, length u32)(ret u32)",
-	"writer1.copy_from_slice(s[] u8)(ret u64)",
-	"writer1.copy_from_slice32(s[] u8, length u32)(ret u32)",
+	"writer1.copy_from_history32!(distance u32, length u32)(ret u32)",
+	"writer1.copy_from_reader32!(r reader1, length u32)(ret u32)",
+	"writer1.copy_from_slice!(s[] u8)(ret u64)",
+	"writer1.copy_from_slice32!(s[] u8, length u32)(ret u32)",
 	"writer1.is_marked()(ret bool)",
 	"writer1.limit(l u64)(ret writer1)",
-	"writer1.mark()()",
+	"writer1.mark!()()",
 	"writer1.since_mark()(ret[] u8)",
 
 	"image_config.initialize!(width u32, height u32, color_model u32)()",
@@ -137,12 +137,45 @@ const (
 	GenericReplaceTo   = t.IDDiamond
 )
 
+// NumFuncs are the built-in, receiver-less functions on numeric values, keyed
+// by name. The value is the function's argument names, in order. Like other
+// functions, they are called with named arguments, such as "min(a:x, b:y)",
+// but they are special-cased by the type and bounds checkers and by the code
+// generators.
+var NumFuncs = map[string][]string{
+	"abs":              {"x"},
+	"assume_in_bounds": {"x", "lo", "hi"},
+	"clz":              {"x"},
+	"max":              {"a", "b"},
+	"min":              {"a", "b"},
+	"popcount":         {"x"},
+	"sign":             {"x"},
+}
+
+// NumFuncName returns the name of the built-in numeric function that n calls,
+// or "" if n is not such a call. It does not check the number of arguments,
+// which the type checker does.
+func NumFuncName(tm *t.Map, n *a.Expr) string {
+	if n.Operator().Key() != t.KeyOpenParen {
+		return ""
+	}
+	lhs := n.LHS().Expr()
+	if lhs.Operator() != 0 || !lhs.Ident().IsIdent() {
+		return ""
+	}
+	name := lhs.Ident().Str(tm)
+	if _, ok := NumFuncs[name]; !ok {
+		return ""
+	}
+	return name
+}
+
 var SliceFuncs = []string{
 	// The "T" types here are generic placeholders for every "[] etc" slice
 	// type. When parsing these strings (e.g. in the lang/check package), "T"
 	// will be replaced by the "◊" diamond to denote a generic slice method, to
 	// avoid any possible ambiguity with a user-defined, non-generic "T" type.
-	"T.copy_from_slice(s T)(ret u64)",
+	"T.copy_from_slice!(s T)(ret u64)",
 	"T.length()(ret u64)",
 	"T.prefix(up_to u64)(ret T)",
 	"T.suffix(up_to u64)(ret T)",
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
@@ -355,3 +356,130 @@ func proveReasonRequirement(q *checker, op t.ID, lhs *a.Expr, rhs *a.Expr) error
 	}
 	return nil
 }
+
+// bcheckPrecondition proves that the callee f's pre condition holds for the
+// call n, given the caller's facts. The condition is restated in the caller's
+// terms: "in.x" becomes the call's x argument, and "this" becomes the call's
+// receiver.
+func (q *checker) bcheckPrecondition(n *a.Expr, f *a.Func, pre *a.Assert) error {
+	args := map[t.ID]*a.Expr{}
+	for _, o := range n.Args() {
+		o := o.Arg()
+		args[o.Name()] = o.Value()
+	}
+	receiver := (*a.Expr)(nil)
+	if lhs := n.LHS().Expr(); lhs.Operator().Key() == t.KeyDot {
+		receiver = lhs.LHS().Expr()
+	}
+
+	condition, ok := substituteCallee(pre.Condition(), args, receiver)
+	reasonArgs := make([]*a.Node, 0, len(pre.Args()))
+	for _, o := range pre.Args() {
+		o := o.Arg()
+		v, vOK := substituteCallee(o.Value(), args, receiver)
+		ok = ok && vOK
+		reasonArgs = append(reasonArgs, a.NewArg(o.Name(), v).Node())
+	}
+	if !ok {
+		// TODO: restate conditions that refer to this for calls that have no
+		// receiver.
+		q.recordObligation(ObligationPrecondition, false)
+		return nil
+	}
+
+	err := q.proveAssert(a.NewAssert(pre.Keyword(), condition, pre.Reason(), reasonArgs))
+	if err == nil {
+		q.recordObligation(ObligationPrecondition, true)
+		return nil
+	}
+
+	facts := "none"
+	if len(q.facts) > 0 {
+		ss := make([]string, len(q.facts))
+		for i, x := range q.facts {
+			ss[i] = x.Str(q.tm)
+		}
+		facts = strings.Join(ss, ", ")
+	}
+	msg := fmt.Sprintf("check: cannot prove %q, the precondition %q of %s, for the call %q; "+
+		"the caller's facts are: %s", condition.Str(q.tm), pre.Condition().Str(q.tm),
+		f.QQID().Str(q.tm), n.Str(q.tm), facts)
+	if err != errFailed {
+		msg += fmt.Sprintf(" (%v)", err)
+	}
+	if !mentionsLocalVar(condition) {
+		msg += fmt.Sprintf("; if the caller cannot prove it, consider adding \"pre %s\" to %s's own "+
+			"preconditions", condition.Str(q.tm), q.astFunc.QQID().Str(q.tm))
+	}
+	return errors.New(msg)
+}
+
+// substituteCallee returns n with every "in.x" replaced by args[x] and every
+// "this" replaced by receiver. It returns false if n refers to an argument
+// that is not in args, or to this when receiver is nil.
+func substituteCallee(n *a.Expr, args map[t.ID]*a.Expr, receiver *a.Expr) (*a.Expr, bool) {
+	if n == nil {
+		return nil, true
+	}
+	switch {
+	case n.Operator().Key() == t.KeyDot && n.LHS().Expr().Operator() == 0 &&
+		n.LHS().Expr().Ident().Key() == t.KeyIn:
+		v := args[n.Ident()]
+		return v, v != nil
+	case n.Operator() == 0 && n.Ident().Key() == t.KeyThis:
+		return receiver, receiver != nil
+	}
+
+	changed, ok := false, true
+	sub := func(o *a.Node) *a.Node {
+		if o == nil || o.Kind() != a.KExpr {
+			return o
+		}
+		x, xOK := substituteCallee(o.Expr(), args, receiver)
+		if !xOK {
+			ok = false
+			return o
+		}
+		if x != o.Expr() {
+			changed = true
+		}
+		return x.Node()
+	}
+	lhs, mhs, rhs := sub(n.LHS()), sub(n.MHS()), sub(n.RHS())
+	nArgs := make([]*a.Node, len(n.Args()))
+	for i, o := range n.Args() {
+		if o.Kind() == a.KArg {
+			o := o.Arg()
+			nArgs[i] = a.NewArg(o.Name(), sub(o.Value().Node()).Expr()).Node()
+		} else {
+			nArgs[i] = sub(o)
+		}
+	}
+	if !ok || !changed {
+		return n, ok
+	}
+	ret := a.NewExpr(n.Node().Raw().Flags(), n.Operator(), n.StatusQID()[0], n.Ident(), lhs, mhs, rhs, nArgs)
+	ret.SetMType(n.MType())
+	ret.SetConstValue(n.ConstValue())
+	return ret, true
+}
+
+// mentionsLocalVar returns whether n refers to a local variable, or to "out",
+// neither of which can appear in a function's pre conditions.
+func mentionsLocalVar(n *a.Expr) bool {
+	return n.Node().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.Expr()
+		if x.Operator() != 0 || x.ConstValue() != nil || x.GlobalIdent() || !x.Ident().IsIdent() {
+			return nil
+		}
+		switch x.Ident().Key() {
+		case t.KeyIn, t.KeyThis:
+			return nil
+		}
+		// This includes "out", which names the function's results.
+		return errFailed
+	}) != nil
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/google/wuffs/lang/builtin"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -195,7 +197,12 @@ func typeBounds(tm *t.Map, typ *a.TypeExpr) (*big.Int, *big.Int, error) {
 	return b[0], b[1], nil
 }
 
-func bcheckField(tm *t.Map, n *a.Field) error {
+// bcheckField checks that a struct field's or function in-param's default
+// value is within the bounds of its (possibly refined) type. A struct field
+// without an explicit default value is zero-initialized, so zero has to be
+// within bounds, but an in-param without one is a required argument, and the
+// caller's argument is bounds checked instead.
+func bcheckField(tm *t.Map, n *a.Field, inParam bool) error {
 	innTyp := n.XType().Innermost()
 	nMin, nMax, err := typeBounds(tm, innTyp)
 	if err != nil {
@@ -211,12 +218,18 @@ func bcheckField(tm *t.Map, n *a.Field) error {
 	dv := zero
 	if o := n.DefaultValue(); o != nil {
 		dv = o.ConstValue()
+	} else if inParam {
+		return nil
 	}
-	if dv.Cmp(nMin) < 0 || dv.Cmp(nMax) > 0 {
-		return fmt.Errorf("check: default value %v is not within bounds [%v..%v] for field %q",
-			dv, nMin, nMax, n.Name().Str(tm))
+	if dv.Cmp(nMin) >= 0 && dv.Cmp(nMax) <= 0 {
+		return nil
 	}
-	return nil
+	if inParam {
+		return fmt.Errorf("check: default value %v is not within bounds [%v..%v], of type %q, for in-param %q",
+			dv, nMin, nMax, n.XType().Str(tm), n.Name().Str(tm))
+	}
+	return fmt.Errorf("check: default value %v is not within bounds [%v..%v] for field %q",
+		dv, nMin, nMax, n.Name().Str(tm))
 }
 
 func (q *checker) bcheckBlock(block []*a.Node) error {
@@ -332,8 +345,28 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 func (q *checker) bcheckAssert(n *a.Assert) error {
 	// TODO: check, here or elsewhere, that the condition is pure.
 	condition := n.Condition()
+	if err := q.proveAssert(n); err != nil {
+		if err == errFailed {
+			return fmt.Errorf("check: cannot prove %q", condition.Str(q.tm))
+		}
+		return fmt.Errorf("check: cannot prove %q: %v", condition.Str(q.tm), err)
+	}
+	o, err := simplify(q.tm, condition)
+	if err != nil {
+		return err
+	}
+	q.facts.appendFact(o)
+	return nil
+}
+
+// proveAssert returns nil if n's condition follows from the current facts,
+// without adding that condition to the facts. It returns errFailed, or a more
+// specific error, if not.
+func (q *checker) proveAssert(n *a.Assert) error {
+	condition := n.Condition()
+	flatCondition := a.Flatten(condition)
 	for _, x := range q.facts {
-		if x.Eq(condition) {
+		if x.Eq(condition) || a.Flatten(x).Eq(flatCondition) {
 			return nil
 		}
 	}
@@ -352,19 +385,7 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 	} else if condition.Operator().IsBinaryOp() && condition.Operator().Key() != t.KeyAs {
 		err = q.proveBinaryOp(condition.Operator().Key(), condition.LHS().Expr(), condition.RHS().Expr())
 	}
-
-	if err != nil {
-		if err == errFailed {
-			return fmt.Errorf("check: cannot prove %q", condition.Str(q.tm))
-		}
-		return fmt.Errorf("check: cannot prove %q: %v", condition.Str(q.tm), err)
-	}
-	o, err := simplify(q.tm, condition)
-	if err != nil {
-		return err
-	}
-	q.facts.appendFact(o)
-	return nil
+	return err
 }
 
 func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
@@ -468,6 +489,9 @@ func (q *checker) bcheckAssignment2(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs
 			if (lMin != nil && cv.Cmp(lMin) < 0) || (lMax != nil && cv.Cmp(lMax) > 0) {
 				return fmt.Errorf("check: constant %v is not within bounds [%v..%v]", cv, lMin, lMax)
 			}
+			if lMin != nil && lMax != nil {
+				q.recordObligation(ObligationOverflow, true)
+			}
 			return nil
 		}
 		rMin, rMax, err = q.bcheckExpr(rhs, 0)
@@ -490,6 +514,11 @@ func (q *checker) bcheckAssignment2(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs
 				rMin, rMax, lMin, lMax)
 		}
 	}
+	// Only an assignment with numeric bounds on both sides is an overflow
+	// obligation. Others, such as of a slice or struct, have nothing to prove.
+	if lMin != nil && lMax != nil && rMin != nil && rMax != nil {
+		q.recordObligation(ObligationOverflow, true)
+	}
 	return nil
 }
 
@@ -618,7 +647,11 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		if err := q.bcheckAssert(o.Assert()); err != nil {
 			return err
 		}
+		if o.Assert().Keyword().Key() == t.KeyPre {
+			q.recordObligation(ObligationPrecondition, true)
+		}
 	}
+	inferred := q.inferLoopInvariant(n)
 
 	// Check the while condition.
 	//
@@ -646,6 +679,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 			}
 			q.facts.appendFact(o.Assert().Condition())
 		}
+		if inferred != nil {
+			q.facts.appendFact(inferred)
+		}
 		if inverse, err := invert(q.tm, n.Condition()); err != nil {
 			return err
 		} else {
@@ -672,6 +708,9 @@ func (q *checker) bcheckWhile(n *a.While) error {
 			}
 			q.facts.appendFact(o.Assert().Condition())
 		}
+		if inferred != nil {
+			q.facts.appendFact(inferred)
+		}
 		// ...and the while condition, unless it is the redundant "true".
 		if cv == nil {
 			q.facts.appendFact(n.Condition())
@@ -702,9 +741,89 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		}
 		q.facts.appendFact(o.Assert().Condition())
 	}
+	if inferred != nil {
+		q.facts.appendFact(inferred)
+	}
 	return nil
 }
 
+// inferLoopInvariant returns the "i <= n" invariant of a canonical counting
+// loop, "while i < n { etc; i += 1 }", or nil if n does not match that
+// pattern or if "i <= n" cannot be proven on entry.
+//
+// The invariant doesn't need to be proven after the body, or on a break,
+// because the pattern guarantees it: "i < n" holds at the top of the body,
+// nothing else in the body modifies i or n and the body's final statement
+// increments i by one. There must be no continue, which would skip that
+// increment.
+func (q *checker) inferLoopInvariant(n *a.While) *a.Expr {
+	cond := n.Condition()
+	if cond.Operator().Key() != t.KeyXBinaryLessThan || n.HasContinue() {
+		return nil
+	}
+	i, limit := cond.LHS().Expr(), cond.RHS().Expr()
+	if i.Operator() != 0 || !i.Ident().IsIdent() || !i.MType().IsNumType() || !limit.Pure() {
+		return nil
+	}
+	// The limit must be a constant, a local variable or an in-parameter.
+	switch {
+	case limit.ConstValue() != nil:
+	case limit.Operator() == 0 && limit.Ident().IsIdent():
+	case limit.Operator().Key() == t.KeyDot && limit.LHS().Expr().Operator() == 0 &&
+		limit.LHS().Expr().Ident().Key() == t.KeyIn:
+	default:
+		return nil
+	}
+
+	body := n.Body()
+	if len(body) == 0 {
+		return nil
+	}
+	if last := body[len(body)-1]; last.Kind() != a.KAssign {
+		return nil
+	} else if o := last.Assign(); o.Operator().Key() != t.KeyPlusEq || !o.LHS().Eq(i) ||
+		o.RHS().ConstValue() == nil || o.RHS().ConstValue().Cmp(one) != 0 {
+		return nil
+	}
+	modified := false
+	for _, o := range body[:len(body)-1] {
+		o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KAssign:
+				if lhs := o.Assign().LHS(); lhs.Eq(i) || limit.Mentions(lhs) {
+					modified = true
+				}
+			case a.KVar:
+				if name := o.Var().Name(); name == i.Ident() ||
+					(limit.Operator() == 0 && name == limit.Ident()) {
+					modified = true
+				}
+			}
+			return nil
+		})
+	}
+	if modified {
+		return nil
+	}
+
+	o := a.NewExpr(a.FlagsTypeChecked, t.IDXBinaryLessEq, 0, 0, i.Node(), nil, limit.Node(), nil)
+	o.SetMType(typeExprBool)
+	if err := q.bcheckAssert(a.NewAssert(t.IDInv, o, 0, nil)); err != nil {
+		// Fall back to comparing the two sides' ranges, which proves the
+		// common case of a counter starting at zero.
+		_, iMax, err := q.bcheckExpr(i, 0)
+		if err != nil || iMax == nil {
+			return nil
+		}
+		lMin, _, err := q.bcheckExpr(limit, 0)
+		if err != nil || lMin == nil || iMax.Cmp(lMin) > 0 {
+			return nil
+		}
+		q.facts.appendFact(o)
+	}
+	return o
+}
+
 func (q *checker) bcheckVar(n *a.Var) error {
 	if innTyp := n.XType().Innermost(); innTyp.IsRefined() {
 		if _, _, err := typeBounds(q.tm, innTyp); err != nil {
@@ -768,7 +887,7 @@ func (q *checker) bcheckExpr1(n *a.Expr, depth uint32) (*big.Int, *big.Int, erro
 	case t.FlagsAssociativeOp:
 		return q.bcheckExprAssociativeOp(n, depth)
 	}
-	return nil, nil, fmt.Errorf("check: unrecognized token.Key (0x%X) for bcheckExpr", n.Operator().Key())
+	return nil, nil, q.errOperatorFlags(n, "bcheckExpr")
 }
 
 func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (*big.Int, *big.Int, error) {
@@ -777,6 +896,9 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (*big.Int, *big.Int,
 		// No-op.
 
 	case t.KeyOpenParen, t.KeyTry:
+		if name := builtin.NumFuncName(q.tm, n); name != "" {
+			return q.bcheckBuiltInNumCall(n, name, depth)
+		}
 		if _, _, err := q.bcheckExpr(n.LHS().Expr(), depth); err != nil {
 			return nil, nil, err
 		}
@@ -888,11 +1010,12 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (*big.Int, *big.Int,
 		}
 
 		if err := proveReasonRequirement(q, t.IDXBinaryLessEq, zeroExpr, rhs); err != nil {
-			return nil, nil, err
+			return nil, nil, q.errIndexStep(n, err)
 		}
 		if err := proveReasonRequirement(q, t.IDXBinaryLessThan, rhs, lengthExpr); err != nil {
-			return nil, nil, err
+			return nil, nil, q.errIndexStep(n, err)
 		}
+		q.recordObligation(ObligationArrayBound, true)
 
 	case t.KeyColon:
 		lhs := n.LHS().Expr()
@@ -929,6 +1052,7 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (*big.Int, *big.Int,
 				return nil, nil, err
 			}
 		}
+		q.recordObligation(ObligationArrayBound, true)
 		return nil, nil, nil
 
 	case t.KeyDot:
@@ -959,7 +1083,7 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (*big.Int, *big.Int,
 }
 
 func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
-	// TODO: handle func pre/post conditions.
+	// TODO: handle func post conditions.
 	//
 	// TODO: bcheck the receiver, e.g. ptr vs nptr.
 	lhs := n.LHS().Expr()
@@ -973,9 +1097,25 @@ func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
 			return err
 		}
 	}
+	for _, o := range f.Asserts() {
+		if o.Assert().Keyword().Key() == t.KeyPre {
+			if err := q.bcheckPrecondition(n, f, o.Assert()); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// errIndexStep reports that the index n, which can be one step of a chain like
+// "this.a[i].b[j]", cannot be proven in range. Naming n, not just the whole
+// chain, says which step failed.
+func (q *checker) errIndexStep(n *a.Expr, err error) error {
+	lhs := n.LHS().Expr()
+	return fmt.Errorf("check: index %q of %q, of type %q, is not proven in range: %v",
+		n.RHS().Expr().Str(q.tm), lhs.Str(q.tm), lhs.MType().Str(q.tm), err)
+}
+
 func makeSliceLengthExpr(slice *a.Expr) *a.Expr {
 	x := a.NewExpr(a.FlagsTypeChecked, t.IDDot, 0, t.IDLength, slice.Node(), nil, nil, nil)
 	x.SetMType(typeExprPlaceholder) // HACK.
@@ -1121,6 +1261,7 @@ func (q *checker) bcheckExprBinaryOp1(op t.Key, lhs *a.Expr, lMin *big.Int, lMax
 		if rMin.Sign() <= 0 {
 			return nil, nil, fmt.Errorf("check: modulus op argument %q is possibly non-positive", rhs.Str(q.tm))
 		}
+		q.recordObligation(ObligationDivisorNonZero, true)
 		return zero, big.NewInt(0).Sub(rMax, one), nil
 
 	case t.KeyXBinaryNotEq, t.KeyXBinaryLessThan, t.KeyXBinaryLessEq, t.KeyXBinaryEqEq,
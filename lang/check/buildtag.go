@@ -0,0 +1,113 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// activeDecls returns those decls that have no "@[if cond]" attribute, or
+// whose cond is true for the given build tags.
+func activeDecls(tm *t.Map, decls []*a.Node, buildTags map[string]string) ([]*a.Node, error) {
+	ret := make([]*a.Node, 0, len(decls))
+	for _, n := range decls {
+		if cond := n.Raw().BuildIf(); cond != nil {
+			active, err := evalBuildIf(tm, cond, buildTags)
+			if err != nil {
+				filename, line := n.Raw().FilenameLine()
+				return nil, &Error{
+					Err:      err,
+					Filename: filename,
+					Line:     line,
+				}
+			}
+			if !active {
+				continue
+			}
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+// evalBuildIf evaluates a build condition. A condition is true or false, a
+// comparison of a build tag with a string literal, such as `target == "wasm"`,
+// or a combination of conditions with "and", "or" and "not".
+func evalBuildIf(tm *t.Map, n *a.Expr, buildTags map[string]string) (bool, error) {
+	switch n.Operator().Key() {
+	case 0:
+		switch n.Ident().Key() {
+		case t.KeyFalse:
+			return false, nil
+		case t.KeyTrue:
+			return true, nil
+		}
+
+	case t.KeyXUnaryNot:
+		b, err := evalBuildIf(tm, n.RHS().Expr(), buildTags)
+		return !b, err
+
+	case t.KeyXBinaryAnd, t.KeyXBinaryOr:
+		l, err := evalBuildIf(tm, n.LHS().Expr(), buildTags)
+		if err != nil {
+			return false, err
+		}
+		r, err := evalBuildIf(tm, n.RHS().Expr(), buildTags)
+		if err != nil {
+			return false, err
+		}
+		if n.Operator().Key() == t.KeyXBinaryAnd {
+			return l && r, nil
+		}
+		return l || r, nil
+
+	case t.KeyXAssociativeAnd, t.KeyXAssociativeOr:
+		isAnd := n.Operator().Key() == t.KeyXAssociativeAnd
+		ret := isAnd
+		for _, o := range n.Args() {
+			b, err := evalBuildIf(tm, o.Expr(), buildTags)
+			if err != nil {
+				return false, err
+			}
+			if isAnd {
+				ret = ret && b
+			} else {
+				ret = ret || b
+			}
+		}
+		return ret, nil
+
+	case t.KeyXBinaryEqEq, t.KeyXBinaryNotEq:
+		lhs, rhs := n.LHS().Expr(), n.RHS().Expr()
+		if lhs.Operator() != 0 || !lhs.Ident().IsIdent() ||
+			rhs.Operator() != 0 || !rhs.Ident().IsStrLiteral() {
+			break
+		}
+		tag := lhs.Ident().Str(tm)
+		got, ok := buildTags[tag]
+		if !ok {
+			return false, fmt.Errorf("check: unknown build tag %q", tag)
+		}
+		want, ok := t.Unescape(rhs.Ident().Str(tm))
+		if !ok {
+			break
+		}
+		return (got == want) == (n.Operator().Key() == t.KeyXBinaryEqEq), nil
+	}
+	return false, fmt.Errorf("check: invalid build condition %q", n.Str(tm))
+}
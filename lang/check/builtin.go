@@ -0,0 +1,432 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/google/wuffs/lang/builtin"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// unsignedTypeExprs maps from a signed integer type to the unsigned integer
+// type of the same width.
+var unsignedTypeExprs = [...]*a.TypeExpr{
+	t.KeyI8:  typeExprU8,
+	t.KeyI16: typeExprU16,
+	t.KeyI32: typeExprU32,
+	t.KeyI64: typeExprU64,
+}
+
+func (q *checker) tcheckBuiltInNumCall(n *a.Expr, name string, depth uint32) error {
+	argNames := builtin.NumFuncs[name]
+	args := n.Args()
+	if len(args) != len(argNames) {
+		return fmt.Errorf("check: built-in %s has %d arguments but %d were given",
+			name, len(argNames), len(args))
+	}
+	for i, o := range args {
+		o := o.Arg()
+		if got, want := o.Name().Str(q.tm), argNames[i]; got != want {
+			return fmt.Errorf("check: argument name: got %q, want %q", got, want)
+		}
+		v := o.Value()
+		if err := q.tcheckExpr(v, depth); err != nil {
+			return err
+		}
+		if vTyp := v.MType(); !vTyp.IsNumTypeOrIdeal() {
+			return fmt.Errorf("check: %s argument %q, of type %q, does not have a numeric type",
+				name, v.Str(q.tm), vTyp.Str(q.tm))
+		}
+		if v.Impure() {
+			return fmt.Errorf("check: %s argument %q is not pure", name, v.Str(q.tm))
+		}
+		o.Node().SetTypeChecked()
+	}
+	n.LHS().SetTypeChecked()
+	n.LHS().Expr().SetMType(typeExprPlaceholder) // HACK.
+
+	switch name {
+	case "abs", "sign":
+		return q.tcheckAbsSign(n, name)
+	case "assume_in_bounds":
+		return q.tcheckAssumeInBounds(n)
+	case "clz", "popcount":
+		return q.tcheckClzPopcount(n, name)
+	}
+	return q.tcheckMinMax(n, name)
+}
+
+func (q *checker) tcheckMinMax(n *a.Expr, name string) error {
+	args := n.Args()
+
+	// Find the arguments' common type: the unrefined type of any non-ideal
+	// argument, or the ideal type if all of the arguments are ideal.
+	typ := typeExprIdeal
+	for _, o := range args {
+		vTyp := o.Arg().Value().MType()
+		if vTyp.IsIdeal() {
+			continue
+		}
+		if typ.IsIdeal() {
+			typ = vTyp.Unrefined()
+		} else if !typ.EqIgnoringRefinements(vTyp) {
+			return fmt.Errorf("check: %s arguments have different types %q and %q",
+				name, typ.Str(q.tm), vTyp.Str(q.tm))
+		}
+	}
+
+	// Compute the result's range from the arguments' ranges.
+	tMin, tMax, err := typeBounds(q.tm, typ)
+	if err != nil {
+		return err
+	}
+	nMin, nMax := (*big.Int)(nil), (*big.Int)(nil)
+	for i, o := range args {
+		v := o.Arg().Value()
+		vMin, vMax, err := argBounds(q.tm, v)
+		if err != nil {
+			return err
+		}
+		if v.ConstValue() != nil && tMin != nil && (vMin.Cmp(tMin) < 0 || vMax.Cmp(tMax) > 0) {
+			return fmt.Errorf("check: %s argument %q is not within the bounds [%v..%v] of type %q",
+				name, v.Str(q.tm), tMin, tMax, typ.Str(q.tm))
+		}
+		if i == 0 {
+			nMin, nMax = vMin, vMax
+		} else if name == "min" {
+			nMin, nMax = min(nMin, vMin), min(nMax, vMax)
+		} else {
+			nMin, nMax = max(nMin, vMin), max(nMax, vMax)
+		}
+	}
+	return q.setNumResult(n, typ, nMin, nMax)
+}
+
+func (q *checker) tcheckAbsSign(n *a.Expr, name string) error {
+	v := n.Args()[0].Arg().Value()
+	vTyp := v.MType()
+	if vTyp.IsIdeal() {
+		cv := v.ConstValue()
+		if name == "abs" {
+			n.SetConstValue(big.NewInt(0).Abs(cv))
+		} else {
+			n.SetConstValue(big.NewInt(int64(cv.Sign())))
+		}
+		n.SetMType(typeExprIdeal)
+		return nil
+	}
+
+	key := vTyp.QID()[1].Key()
+	if key >= t.Key(len(unsignedTypeExprs)) || unsignedTypeExprs[key] == nil {
+		if name == "sign" {
+			return fmt.Errorf("check: sign argument %q, of type %q, does not have a signed type",
+				v.Str(q.tm), vTyp.Str(q.tm))
+		}
+		q.warnf(WarningRedundantAbs, "redundant abs of %q, of unsigned type %q",
+			v.Str(q.tm), vTyp.Str(q.tm))
+		n.SetConstValue(v.ConstValue())
+		n.SetMType(vTyp)
+		return nil
+	}
+
+	vMin, vMax, err := argBounds(q.tm, v)
+	if err != nil {
+		return err
+	}
+	if name == "sign" {
+		return q.setNumResult(n, typeExprI8,
+			big.NewInt(int64(vMin.Sign())), big.NewInt(int64(vMax.Sign())))
+	}
+	// The result type is unsigned, as abs of the most negative iN value, such
+	// as abs(-128) for an i8, is not representable as an iN.
+	nMin, nMax := absBounds(vMin, vMax)
+	return q.setNumResult(n, unsignedTypeExprs[key], nMin, nMax)
+}
+
+// tcheckClzPopcount checks clz(x:etc), the number of leading zero bits, and
+// popcount(x:etc), the number of set bits, of x's unsigned integer type. The
+// result type is u8, refined to [0..N] for an N-bit type. clz of zero is N.
+func (q *checker) tcheckClzPopcount(n *a.Expr, name string) error {
+	v := n.Args()[0].Arg().Value()
+	vTyp := v.MType()
+	if vTyp.IsIdeal() {
+		cv := v.ConstValue()
+		if name == "clz" {
+			return fmt.Errorf("check: clz argument %q has an ideal number type, which has no bit width; "+
+				"use a constant of an unsigned type instead", v.Str(q.tm))
+		}
+		if cv.Sign() < 0 {
+			return fmt.Errorf("check: popcount argument %q is negative", v.Str(q.tm))
+		}
+		n.SetConstValue(big.NewInt(int64(popcount(cv))))
+		n.SetMType(typeExprIdeal)
+		return nil
+	}
+	if !vTyp.IsUnsignedInteger() {
+		return fmt.Errorf("check: %s argument %q, of type %q, does not have an unsigned integer type",
+			name, v.Str(q.tm), vTyp.Str(q.tm))
+	}
+
+	vMin, vMax, err := argBounds(q.tm, v)
+	if err != nil {
+		return err
+	}
+	_, tMax, err := typeBounds(q.tm, vTyp.Unrefined())
+	if err != nil {
+		return err
+	}
+	nMin, nMax := clzPopcountBounds(name, tMax.BitLen(), vMin, vMax)
+	return q.setNumResult(n, typeExprU8, nMin, nMax)
+}
+
+// tcheckAssumeInBounds checks assume_in_bounds(x:etc, lo:etc, hi:etc), whose
+// result is x refined to the range [lo..hi]. Instead of requiring the bounds
+// checker to prove that x is within that range, the code generators check it
+// at run time, unless the bounds checker can prove it after all. It is an
+// error if x can never be within that range.
+//
+// A failed run time check returns an error status, and is written before the
+// statement that contains it, so assume_in_bounds is only allowed in a
+// suspendible function, and not in an if, while or iterate condition.
+func (q *checker) tcheckAssumeInBounds(n *a.Expr) error {
+	if q.inCondition {
+		return fmt.Errorf("check: assume_in_bounds call %q is not allowed in a condition; "+
+			"assign its result to a local variable first", n.Str(q.tm))
+	}
+	if q.astFunc == nil || !q.astFunc.Suspendible() {
+		return fmt.Errorf("check: assume_in_bounds call %q is not allowed in a non-suspendible function, "+
+			"which cannot return its run time check's error status", n.Str(q.tm))
+	}
+	args := n.Args()
+	x := args[0].Arg().Value()
+	xTyp := x.MType()
+	if xTyp.IsIdeal() {
+		return fmt.Errorf("check: assume_in_bounds argument %q has an ideal number type; "+
+			"use a constant of the refined type instead", x.Str(q.tm))
+	}
+	bounds := [2]*big.Int{}
+	for i, o := range args[1:] {
+		v := o.Arg().Value()
+		if bounds[i] = v.ConstValue(); bounds[i] == nil {
+			return fmt.Errorf("check: assume_in_bounds argument %q is not constant", v.Str(q.tm))
+		}
+	}
+	lo, hi := bounds[0], bounds[1]
+	if lo.Cmp(hi) > 0 {
+		return fmt.Errorf("check: assume_in_bounds range [%v..%v] is empty", lo, hi)
+	}
+	typ := xTyp.Unrefined()
+	tMin, tMax, err := typeBounds(q.tm, typ)
+	if err != nil {
+		return err
+	}
+	if lo.Cmp(tMin) < 0 || hi.Cmp(tMax) > 0 {
+		return fmt.Errorf("check: assume_in_bounds range [%v..%v] is not within the bounds [%v..%v] of type %q",
+			lo, hi, tMin, tMax, typ.Str(q.tm))
+	}
+	xMin, xMax, err := argBounds(q.tm, x)
+	if err != nil {
+		return err
+	}
+	if err := checkAssumeInBoundsOverlap(q.tm, x, xMin, xMax, lo, hi); err != nil {
+		return err
+	}
+
+	// Unlike setNumResult, never set a ConstValue, even if lo equals hi, as
+	// that would drop the run time check.
+	if lo.Cmp(tMin) == 0 && hi.Cmp(tMax) == 0 {
+		n.SetMType(typ)
+		return nil
+	}
+	rTyp, err := q.refinedTypeExpr(typ, lo, hi)
+	if err != nil {
+		return err
+	}
+	n.SetMType(rTyp)
+	return nil
+}
+
+// checkAssumeInBoundsOverlap returns an error if x, in the range [xMin ..
+// xMax], can never be within the range [lo .. hi].
+func checkAssumeInBoundsOverlap(tm *t.Map, x *a.Expr, xMin *big.Int, xMax *big.Int, lo *big.Int, hi *big.Int) error {
+	if xMax.Cmp(lo) < 0 || xMin.Cmp(hi) > 0 {
+		return fmt.Errorf("check: assume_in_bounds argument %q, in the range [%v..%v], "+
+			"can never be within the range [%v..%v]", x.Str(tm), xMin, xMax, lo, hi)
+	}
+	return nil
+}
+
+// clzPopcountBounds returns the range of clz(x) or popcount(x), where x is
+// a width-bit unsigned integer, for x in the range [xMin .. xMax].
+func clzPopcountBounds(name string, width int, xMin *big.Int, xMax *big.Int) (*big.Int, *big.Int) {
+	if xMin.Cmp(xMax) == 0 {
+		if name == "clz" {
+			c := big.NewInt(int64(width - xMin.BitLen()))
+			return c, c
+		}
+		c := big.NewInt(int64(popcount(xMin)))
+		return c, c
+	}
+	if name == "clz" {
+		// clz is monotonically decreasing.
+		return big.NewInt(int64(width - xMax.BitLen())), big.NewInt(int64(width - xMin.BitLen()))
+	}
+	// popcount(x) is at least 1 for a non-zero x, and at most x's bit length.
+	nMin := zero
+	if xMin.Sign() > 0 {
+		nMin = one
+	}
+	return nMin, big.NewInt(int64(xMax.BitLen()))
+}
+
+// popcount returns the number of set bits in x, which must be non-negative.
+func popcount(x *big.Int) int {
+	n := 0
+	for i := 0; i < x.BitLen(); i++ {
+		n += int(x.Bit(i))
+	}
+	return n
+}
+
+// absBounds returns the range of abs(x) for x in the range [xMin .. xMax].
+func absBounds(xMin *big.Int, xMax *big.Int) (*big.Int, *big.Int) {
+	if xMin.Sign() >= 0 {
+		return xMin, xMax
+	}
+	if xMax.Sign() <= 0 {
+		return neg(xMax), neg(xMin)
+	}
+	return zero, max(neg(xMin), xMax)
+}
+
+// argBounds returns the range of the built-in function argument v: either its
+// constant value or the bounds of its (possibly refined) type.
+func argBounds(tm *t.Map, v *a.Expr) (*big.Int, *big.Int, error) {
+	if cv := v.ConstValue(); cv != nil {
+		return cv, cv, nil
+	}
+	return typeBounds(tm, v.MType())
+}
+
+// setNumResult sets n's MType and, if nMin equals nMax, its ConstValue. The
+// MType is typ, a numeric type, refined to the range [nMin .. nMax] if that is
+// narrower than typ's range.
+func (q *checker) setNumResult(n *a.Expr, typ *a.TypeExpr, nMin *big.Int, nMax *big.Int) error {
+	if nMin.Cmp(nMax) == 0 {
+		n.SetConstValue(nMin)
+		n.SetMType(typ)
+		return nil
+	}
+	tMin, tMax, err := typeBounds(q.tm, typ)
+	if err != nil {
+		return err
+	}
+	if nMin.Cmp(tMin) == 0 && nMax.Cmp(tMax) == 0 {
+		n.SetMType(typ)
+		return nil
+	}
+	rTyp, err := q.refinedTypeExpr(typ, nMin, nMax)
+	if err != nil {
+		return err
+	}
+	n.SetMType(rTyp)
+	return nil
+}
+
+// refinedTypeExpr returns typ, a numeric type, refined to the range [nMin ..
+// nMax].
+func (q *checker) refinedTypeExpr(typ *a.TypeExpr, nMin *big.Int, nMax *big.Int) (*a.TypeExpr, error) {
+	bounds := [2]*a.Expr{}
+	for i, b := range [2]*big.Int{nMin, nMax} {
+		id, err := q.tm.Insert(b.String())
+		if err != nil {
+			return nil, err
+		}
+		o := a.NewExpr(a.FlagsTypeChecked, 0, 0, id, nil, nil, nil, nil)
+		o.SetConstValue(b)
+		o.SetMType(typeExprIdeal)
+		bounds[i] = o
+	}
+	qid := typ.QID()
+	ret := a.NewTypeExpr(0, qid[0], qid[1], bounds[0].Node(), bounds[1], nil)
+	ret.Node().SetTypeChecked()
+	return ret, nil
+}
+
+func (q *checker) bcheckBuiltInNumCall(n *a.Expr, name string, depth uint32) (*big.Int, *big.Int, error) {
+	if name == "assume_in_bounds" {
+		return q.bcheckAssumeInBounds(n, depth)
+	}
+	nMin, nMax := (*big.Int)(nil), (*big.Int)(nil)
+	for i, o := range n.Args() {
+		vMin, vMax, err := q.bcheckExpr(o.Arg().Value(), depth)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case name == "abs":
+			nMin, nMax = absBounds(vMin, vMax)
+		case name == "sign":
+			nMin, nMax = big.NewInt(int64(vMin.Sign())), big.NewInt(int64(vMax.Sign()))
+		case name == "clz" || name == "popcount":
+			vTyp := o.Arg().Value().MType()
+			if vTyp.IsIdeal() {
+				nMin, nMax = clzPopcountBounds(name, vMax.BitLen(), vMin, vMax)
+				break
+			}
+			_, tMax, err := typeBounds(q.tm, vTyp.Unrefined())
+			if err != nil {
+				return nil, nil, err
+			}
+			nMin, nMax = clzPopcountBounds(name, tMax.BitLen(), vMin, vMax)
+		case i == 0:
+			nMin, nMax = vMin, vMax
+		case name == "min":
+			nMin, nMax = min(nMin, vMin), min(nMax, vMax)
+		default:
+			nMin, nMax = max(nMin, vMin), max(nMax, vMax)
+		}
+	}
+	return nMin, nMax, nil
+}
+
+// bcheckAssumeInBounds records assume_in_bounds(x:etc, lo:etc, hi:etc) as a
+// proven obligation if the facts show that x is within [lo..hi], in which case
+// the code generators can skip the run time check, and as a runtime-checked
+// obligation otherwise.
+func (q *checker) bcheckAssumeInBounds(n *a.Expr, depth uint32) (*big.Int, *big.Int, error) {
+	args := n.Args()
+	x := args[0].Arg().Value()
+	xMin, xMax, err := q.bcheckExpr(x, depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	lo := args[1].Arg().Value().ConstValue()
+	hi := args[2].Arg().Value().ConstValue()
+	if err := checkAssumeInBoundsOverlap(q.tm, x, xMin, xMax, lo, hi); err != nil {
+		return nil, nil, err
+	}
+	if xMin.Cmp(lo) >= 0 && xMax.Cmp(hi) <= 0 {
+		q.recordObligation(ObligationRange, true)
+		n.SetBoundsCheckOptimized()
+		return xMin, xMax, nil
+	}
+	q.recordRuntimeCheck(ObligationRange)
+	return max(xMin, lo), min(xMax, hi), nil
+}
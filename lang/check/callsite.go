@@ -0,0 +1,148 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// CallSite is a call expression, within a caller function's body, that the
+// type checker resolved to a callee function.
+//
+// The Filename and Line are those of the call's first token. For a call that
+// was not parsed from source, which records no line, they are those of the
+// statement that contains the call.
+type CallSite struct {
+	Caller   t.QQID
+	Callee   t.QQID
+	Call     *a.Expr
+	Filename string
+	Line     uint32
+}
+
+// CallSites returns every call site whose callee is the function or method
+// with the given QQID, sorted by filename and line. Functions are identified
+// by a QQID, not a QID, as a method's receiver is part of its name.
+//
+// This is the inverse of a function's outgoing calls: the "callers" of qqid.
+func (c *Checker) CallSites(qqid t.QQID) []CallSite {
+	ret := []CallSite(nil)
+	for _, s := range c.callSites {
+		if s.Callee == qqid {
+			ret = append(ret, *s)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Filename != ret[j].Filename {
+			return ret[i].Filename < ret[j].Filename
+		}
+		return ret[i].Line < ret[j].Line
+	})
+	return ret
+}
+
+// recordCallSite records that the call n, in the current function, resolved
+// to the callee f.
+func (q *checker) recordCallSite(n *a.Expr, f *a.Func) {
+	if q.astFunc == nil {
+		return
+	}
+	// The same node can be type-checked more than once, so skip duplicates.
+	if q.c.seenCalls[n] {
+		return
+	}
+	if q.c.seenCalls == nil {
+		q.c.seenCalls = map[*a.Expr]bool{}
+	}
+	q.c.seenCalls[n] = true
+	filename, line := n.Node().Raw().FilenameLine()
+	if line == 0 {
+		filename, line = q.errFilename, q.errLine
+	}
+	q.c.callSites = append(q.c.callSites, &CallSite{
+		Caller:   q.astFunc.QQID(),
+		Callee:   f.QQID(),
+		Call:     n,
+		Filename: filename,
+		Line:     line,
+	})
+}
+
+// checkUnreachableFuncs warns about every private function in this package
+// that is not reachable, through the call graph, from a public function or
+// from a const's value. Public functions are the package's API, and so are
+// always reachable.
+func (c *Checker) checkUnreachableFuncs(_ *a.Node) error {
+	callees := map[t.QQID][]t.QQID{}
+	for _, s := range c.callSites {
+		callees[s.Caller] = append(callees[s.Caller], s.Callee)
+	}
+
+	reachable := map[t.QQID]bool{}
+	var visit func(t.QQID)
+	visit = func(qqid t.QQID) {
+		if reachable[qqid] {
+			return
+		}
+		reachable[qqid] = true
+		for _, o := range callees[qqid] {
+			visit(o)
+		}
+	}
+
+	for qqid, f := range c.funcs {
+		if f.Public() {
+			visit(qqid)
+		}
+	}
+	// A const's value can call a function at compile time, outside of any
+	// caller function, so that call has no CallSite.
+	for _, n := range c.consts {
+		n.Value().Node().Walk(func(o *a.Node) error {
+			if o.Kind() != a.KExpr {
+				return nil
+			}
+			if o := o.Expr(); o.Operator().Key() == t.KeyOpenParen {
+				if lhs := o.LHS().Expr(); lhs.Operator() == 0 {
+					if f := c.freeFuncs[lhs.Ident()]; f != nil {
+						visit(f.QQID())
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	dead := []*a.Func(nil)
+	for qqid, f := range c.funcs {
+		if qqid[0] == 0 && !reachable[qqid] {
+			dead = append(dead, f)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool {
+		if dead[i].Filename() != dead[j].Filename() {
+			return dead[i].Filename() < dead[j].Filename()
+		}
+		return dead[i].Line() < dead[j].Line()
+	})
+	for _, f := range dead {
+		c.warnf(f.Filename(), f.Line(), WarningUnreachableFunc,
+			"private function %q is never called from any public function", f.QQID().Str(c.tm))
+	}
+	return nil
+}
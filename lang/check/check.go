@@ -21,8 +21,11 @@ import (
 	"fmt"
 	"math/big"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/google/wuffs/lang/base38"
+	"github.com/google/wuffs/lang/builtin"
 	"github.com/google/wuffs/lang/parse"
 
 	a "github.com/google/wuffs/lang/ast"
@@ -60,11 +63,34 @@ func (e *Error) Error() string {
 	return string(b)
 }
 
-func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error)) (*Checker, error) {
+type Options struct {
+	// BuildTags are the key-value pairs that "@[if cond]" attributes on top
+	// level declarations are evaluated against, such as "target" => "wasm".
+	// Declarations whose condition is false are removed from their files.
+	BuildTags map[string]string
+
+	// Naming, if non-nil, is the naming policy that declared identifiers are
+	// linted against, with a warning for each violation.
+	Naming *NamingPolicy
+}
+
+func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error), opts *Options) (*Checker, error) {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
 	for _, f := range files {
 		if f == nil {
 			return nil, errors.New("check: Check given a nil *ast.File")
 		}
+		if err := a.ValidateOperatorForms(f.Node()); err != nil {
+			return nil, fmt.Errorf("check: %q: %v", f.Filename(), err)
+		}
+		decls, err := activeDecls(tm, f.TopLevelDecls(), o.BuildTags)
+		if err != nil {
+			return nil, err
+		}
+		f.SetTopLevelDecls(decls)
 	}
 
 	if len(files) > 1 {
@@ -86,11 +112,12 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 	c := &Checker{
 		tm:           tm,
 		resolveUse:   resolveUse,
+		buildTags:    o.BuildTags,
 		reasonMap:    rMap,
 		packageID:    base38.Max + 1,
 		consts:       map[t.QID]*a.Const{},
 		funcs:        map[t.QQID]*a.Func{},
-		localVars:    map[t.QQID]typeMap{},
+		scopes:       map[t.QQID]*Scope{},
 		statuses:     map[t.QID]*a.Status{},
 		structs:      map[t.QID]*a.Struct{},
 		useBaseNames: map[t.ID]struct{}{},
@@ -115,6 +142,10 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 			f.Node().SetTypeChecked()
 		}
 	}
+	if o.Naming != nil {
+		c.checkNaming(files, o.Naming)
+	}
+	c.applyNoWarns(files)
 	return c, nil
 }
 
@@ -126,14 +157,19 @@ var phases = [...]struct {
 	{a.KInvalid, (*Checker).checkPackageIDExists},
 	{a.KUse, (*Checker).checkUse},
 	{a.KStatus, (*Checker).checkStatus},
-	{a.KConst, (*Checker).checkConst},
+	{a.KConst, (*Checker).checkConstDecl},
+	{a.KFunc, (*Checker).recordFreeFunc},
 	{a.KStruct, (*Checker).checkStructDecl},
 	{a.KInvalid, (*Checker).checkStructCycles},
+	{a.KInvalid, (*Checker).checkConstValues},
 	{a.KStruct, (*Checker).checkStructFields},
 	{a.KFunc, (*Checker).checkFuncSignature},
+	{a.KUse, (*Checker).checkUseCollisions},
 	{a.KFunc, (*Checker).checkFuncContract},
 	{a.KFunc, (*Checker).checkFuncBody},
+	{a.KInvalid, (*Checker).checkUnreachableFuncs},
 	{a.KStruct, (*Checker).checkFieldMethodCollisions},
+	{a.KStruct, (*Checker).checkStructSuspendible},
 	// TODO: check consts, funcs, structs and uses for name collisions.
 }
 
@@ -144,16 +180,25 @@ type reasonMap map[t.Key]reason
 type Checker struct {
 	tm         *t.Map
 	resolveUse func(usePath string) ([]byte, error)
+	buildTags  map[string]string
 	reasonMap  reasonMap
 
 	packageID      uint32
 	otherPackageID *a.PackageID
 
-	consts    map[t.QID]*a.Const
-	funcs     map[t.QQID]*a.Func
-	localVars map[t.QQID]typeMap
-	statuses  map[t.QID]*a.Status
-	structs   map[t.QID]*a.Struct
+	consts   map[t.QID]*a.Const
+	funcs    map[t.QQID]*a.Func
+	scopes   map[t.QQID]*Scope
+	statuses map[t.QID]*a.Status
+	structs  map[t.QID]*a.Struct
+
+	// instantiations are the generic structs instantiated so far, keyed by
+	// their type strings such as "ring_buffer[u8]".
+	instantiations map[string]*a.Struct
+
+	// freeFuncs are this package's functions that have no receiver, keyed by
+	// name. Unlike funcs, they are recorded before consts are checked.
+	freeFuncs map[t.ID]*a.Func
 
 	// useBaseNames are the base names of packages referred to by `use
 	// "foo/bar"` lines. The keys are `bar`, not `"foo/bar"`.
@@ -161,7 +206,21 @@ type Checker struct {
 
 	builtInFuncs      map[t.QQID]*a.Func
 	builtInSliceFuncs map[t.QQID]*a.Func
+	unsortedConsts    []*a.Const
 	unsortedStructs   []*a.Struct
+
+	warnings         []*Warning
+	warningsAsErrors bool
+	allowedWarnings  map[WarningCategory]bool
+
+	safety    map[t.QQID]*FuncSafety
+	callSites []*CallSite
+	// seenCalls are the call expressions that have a CallSite.
+	seenCalls map[*a.Expr]bool
+
+	// sizing are the structs whose sizes are being computed, to detect a
+	// "sizeof" in an array length that depends on its own struct's size.
+	sizing map[*a.Struct]bool
 }
 
 func (c *Checker) PackageID() uint32 { return c.packageID }
@@ -206,17 +265,28 @@ func (c *Checker) checkPackageIDExists(node *a.Node) error {
 	return nil
 }
 
-func (c *Checker) checkUse(node *a.Node) error {
-	usePath := node.Use().Path()
+// useName returns the name that a `use "foo/bar"` line's package is referred
+// to by: its alias, as in `use "foo/bar" as baz`, if any, otherwise `bar`. It
+// also returns the filename of the package's source code.
+func (c *Checker) useName(n *a.Use) (name t.ID, filename string, err error) {
+	usePath := n.Path()
 	filename, ok := t.Unescape(usePath.Str(c.tm))
 	if !ok {
-		return fmt.Errorf("check: cannot resolve `use %s`", usePath.Str(c.tm))
+		return 0, "", fmt.Errorf("check: cannot resolve `use %s`", usePath.Str(c.tm))
+	}
+	if name = n.Alias(); name == 0 {
+		if name, err = c.tm.Insert(path.Base(filename)); err != nil {
+			return 0, "", fmt.Errorf("check: cannot resolve `use %s`: %v", usePath.Str(c.tm), err)
+		}
 	}
-	baseName, err := c.tm.Insert(path.Base(filename))
+	return name, filename + ".wuffs", nil
+}
+
+func (c *Checker) checkUse(node *a.Node) error {
+	baseName, filename, err := c.useName(node.Use())
 	if err != nil {
-		return fmt.Errorf("check: cannot resolve `use %s`: %v", usePath.Str(c.tm), err)
+		return err
 	}
-	filename += ".wuffs"
 	if _, ok := c.useBaseNames[baseName]; ok {
 		return fmt.Errorf("check: duplicate `use \"etc\"` base name %q", baseName.Str(c.tm))
 	}
@@ -239,6 +309,12 @@ func (c *Checker) checkUse(node *a.Node) error {
 		return err
 	}
 
+	decls, err := activeDecls(c.tm, f.TopLevelDecls(), c.buildTags)
+	if err != nil {
+		return err
+	}
+	f.SetTopLevelDecls(decls)
+
 	for _, n := range f.TopLevelDecls() {
 		if err := n.Raw().SetPackage(c.tm, baseName); err != nil {
 			return err
@@ -288,6 +364,55 @@ func (c *Checker) checkUse(node *a.Node) error {
 	return nil
 }
 
+// checkUseCollisions checks that the name of a used package is not also the
+// name of one of this package's consts, structs or functions, or of a local
+// variable, which would make references to it ambiguous.
+func (c *Checker) checkUseCollisions(node *a.Node) error {
+	n := node.Use()
+	name, _, err := c.useName(n)
+	if err != nil {
+		return err
+	}
+
+	kind, other := "", (*a.Node)(nil)
+	if o := c.consts[t.QID{0, name}]; o != nil {
+		kind, other = "const", o.Node()
+	} else if o := c.structs[t.QID{0, name}]; o != nil {
+		kind, other = "struct", o.Node()
+	} else if o := c.funcs[t.QQID{0, 0, name}]; o != nil {
+		kind, other = "function", o.Node()
+	} else {
+		for qqid, f := range c.funcs {
+			if qqid[0] != 0 {
+				continue
+			}
+			f.Node().Walk(func(o *a.Node) error {
+				if o.Kind() == a.KVar && o.Var().Name() == name && other == nil {
+					kind, other = "local variable", o
+				}
+				return nil
+			})
+			if other != nil {
+				break
+			}
+		}
+	}
+	if other == nil {
+		return nil
+	}
+
+	otherFilename, otherLine := other.Raw().FilenameLine()
+	return &Error{
+		Err: fmt.Errorf("check: `use %s` package name %q collides with the %s %q; "+
+			"rename one or alias the package, as in `use %s as other_name`",
+			n.Path().Str(c.tm), name.Str(c.tm), kind, name.Str(c.tm), n.Path().Str(c.tm)),
+		Filename:      n.Filename(),
+		Line:          n.Line(),
+		OtherFilename: otherFilename,
+		OtherLine:     otherLine,
+	}
+}
+
 func (c *Checker) checkStatus(node *a.Node) error {
 	n := node.Status()
 	qid := n.QID()
@@ -305,7 +430,7 @@ func (c *Checker) checkStatus(node *a.Node) error {
 	return nil
 }
 
-func (c *Checker) checkConst(node *a.Node) error {
+func (c *Checker) checkConstDecl(node *a.Node) error {
 	n := node.Const()
 	qid := n.QID()
 	if other, ok := c.consts[qid]; ok {
@@ -318,7 +443,124 @@ func (c *Checker) checkConst(node *a.Node) error {
 		}
 	}
 	c.consts[qid] = n
+	c.unsortedConsts = append(c.unsortedConsts, n)
+	return nil
+}
+
+// checkConstValues checks every const's type and value, in dependency order,
+// so that a const can refer to another const declared later in the source.
+// A cycle of consts that refer to each other is an error.
+func (c *Checker) checkConstValues(_ *a.Node) error {
+	// state is 1 for a const whose dependencies are being visited, and 2 for a
+	// const that has been checked.
+	state := map[*a.Const]int{}
+	stack := []*a.Const(nil)
+
+	var visit func(n *a.Const) error
+	visit = func(n *a.Const) error {
+		switch state[n] {
+		case 1:
+			names := []string(nil)
+			for i := len(stack) - 1; i >= 0; i-- {
+				names = append([]string{stack[i].QID().Str(c.tm)}, names...)
+				if stack[i] == n {
+					break
+				}
+			}
+			names = append(names, n.QID().Str(c.tm))
+			return &Error{
+				Err:      fmt.Errorf("check: cyclical const definitions: %s", strings.Join(names, " -> ")),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		case 2:
+			return nil
+		}
+		state[n] = 1
+		stack = append(stack, n)
+		for _, o := range c.constDependencies(n) {
+			if err := visit(o); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = 2
+		if n.Node().TypeChecked() {
+			return nil
+		}
+		return c.checkConst(n)
+	}
 
+	for _, n := range c.unsortedConsts {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// constDependencies returns the other (same package) consts that n's type and
+// value refer to.
+func (c *Checker) constDependencies(n *a.Const) []*a.Const {
+	ret := []*a.Const(nil)
+	seen := map[*a.Const]bool{}
+	seenFuncs := map[*a.Func]bool{}
+	seenStructs := map[*a.Struct]bool{}
+	var walker func(locals map[t.ID]bool) func(o *a.Node) error
+	walker = func(locals map[t.ID]bool) func(o *a.Node) error {
+		return func(o *a.Node) error {
+			if o.Kind() != a.KExpr {
+				return nil
+			}
+			if o := o.Expr(); o.Operator() == 0 && o.Ident().IsIdent() && !locals[o.Ident()] {
+				if k, ok := c.consts[t.QID{0, o.Ident()}]; ok && !seen[k] {
+					seen[k] = true
+					ret = append(ret, k)
+				}
+			} else if o.Operator().Key() == t.KeyOpenParen {
+				// A call evaluated at compile time depends on the consts that
+				// the called function, but not its local variables, refer to.
+				if lhs := o.LHS().Expr(); lhs.Operator() == 0 {
+					if fn := c.freeFuncs[lhs.Ident()]; fn != nil && !seenFuncs[fn] {
+						seenFuncs[fn] = true
+						fnLocals := map[t.ID]bool{}
+						fn.Node().Walk(func(o *a.Node) error {
+							if o.Kind() == a.KVar {
+								fnLocals[o.Var().Name()] = true
+							}
+							return nil
+						})
+						fn.Node().Walk(walker(fnLocals))
+					}
+				}
+			} else if o.Operator().Key() == t.KeySizeof {
+				// A "sizeof(T)" depends on the consts, such as array lengths,
+				// in the types of the fields of the structs that T contains.
+				structs := c.typeReferences([]*a.TypeExpr{o.RHS().TypeExpr()})
+				for len(structs) > 0 {
+					s := structs[0]
+					structs = structs[1:]
+					if seenStructs[s] {
+						continue
+					}
+					seenStructs[s] = true
+					for _, f := range s.Fields() {
+						f.Field().XType().Node().Walk(walker(nil))
+					}
+					structs = append(structs, c.structReferences(s)...)
+				}
+			}
+			return nil
+		}
+	}
+	f := walker(nil)
+	n.XType().Node().Walk(f)
+	n.Value().Node().Walk(f)
+	return ret
+}
+
+func (c *Checker) checkConst(n *a.Const) error {
+	qid := n.QID()
 	q := &checker{
 		c:  c,
 		tm: c.tm,
@@ -349,29 +591,40 @@ func (c *Checker) checkConst(node *a.Node) error {
 	if nMin == nil || nMax == nil {
 		return fmt.Errorf("check: invalid const type %q for %s", n.XType().Str(c.tm), qid.Str(c.tm))
 	}
-	if err := c.checkConstElement(n.Value(), nMin, nMax, nLists); err != nil {
+	if err := c.checkConstElement(n.Value(), typ, nMin, nMax, nLists); err != nil {
 		return fmt.Errorf("check: %v for %s", err, qid.Str(c.tm))
 	}
 	n.Node().SetTypeChecked()
 	return nil
 }
 
-func (c *Checker) checkConstElement(n *a.Expr, nMin *big.Int, nMax *big.Int, nLists int) error {
+func (c *Checker) checkConstElement(n *a.Expr, typ *a.TypeExpr, nMin *big.Int, nMax *big.Int, nLists int) error {
 	if nLists > 0 {
 		nLists--
 		if n.Operator().Key() != t.KeyDollar {
 			return fmt.Errorf("invalid const value %q", n.Str(c.tm))
 		}
 		for _, o := range n.Args() {
-			if err := c.checkConstElement(o.Expr(), nMin, nMax, nLists); err != nil {
+			if err := c.checkConstElement(o.Expr(), typ, nMin, nMax, nLists); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 	if cv := n.ConstValue(); cv == nil || cv.Cmp(nMin) < 0 || cv.Cmp(nMax) > 0 {
+		if cv != nil && n.Operator() != 0 {
+			// Show the value of a computed const, such as "sizeof(T)".
+			return fmt.Errorf("invalid const value %q, which is %v, not within [%v..%v]",
+				n.Str(c.tm), cv, nMin, nMax)
+		}
 		return fmt.Errorf("invalid const value %q not within [%v..%v]", n.Str(c.tm), nMin, nMax)
 	}
+	// A literal's type suffix, as in "42u8", must match the const's type.
+	if n.Operator() == 0 && n.Ident().IsNumLiteral() && !n.MType().IsIdeal() &&
+		!n.MType().EqIgnoringRefinements(typ) {
+		return fmt.Errorf("invalid const value %q, of type %q, for type %q",
+			n.Str(c.tm), n.MType().Str(c.tm), typ.Str(c.tm))
+	}
 	return nil
 }
 
@@ -392,16 +645,119 @@ func (c *Checker) checkStructDecl(node *a.Node) error {
 	return nil
 }
 
+// checkStructCycles checks that the by-value struct graph is acyclic. Today,
+// that graph being well-founded, so that expanding a type expression always
+// finishes, is the same as every struct having a finite size, so one check
+// covers both. They would differ for a generic struct whose type arguments
+// grow with each expansion, which is why checkStructReferences follows type
+// arguments too.
+//
+// a.TopologicalSortStructs, which cgen uses, also follows pointer and slice
+// fields, but checkStructFields rejects those, so its sort cannot then fail.
 func (c *Checker) checkStructCycles(_ *a.Node) error {
-	if _, ok := a.TopologicalSortStructs(c.unsortedStructs); !ok {
-		return fmt.Errorf("check: cyclical struct definitions")
+	return c.checkStructReferences()
+}
+
+// checkStructReferences checks that the graph of structs, with an edge from
+// each struct to those structs that its fields contain by value, is acyclic.
+// A struct cannot contain itself, directly or indirectly, as that struct
+// would be infinitely large, and a type expression naming it would never
+// finish expanding.
+func (c *Checker) checkStructReferences() error {
+	// state is 1 for a struct whose references are being visited, and 2 for
+	// a struct whose references have all been visited.
+	state := map[*a.Struct]int{}
+	stack := []*a.Struct(nil)
+
+	var visit func(n *a.Struct) error
+	visit = func(n *a.Struct) error {
+		switch state[n] {
+		case 1:
+			names := []string(nil)
+			for i := len(stack) - 1; i >= 0; i-- {
+				names = append([]string{stack[i].QID().Str(c.tm)}, names...)
+				if stack[i] == n {
+					break
+				}
+			}
+			names = append(names, n.QID().Str(c.tm))
+			return &Error{
+				Err:      fmt.Errorf("check: cyclical struct definitions: %s", strings.Join(names, " -> ")),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		case 2:
+			return nil
+		}
+		state[n] = 1
+		stack = append(stack, n)
+		for _, o := range c.structReferences(n) {
+			if err := visit(o); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = 2
+		return nil
+	}
+
+	for _, n := range c.unsortedStructs {
+		if err := visit(n); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// structReferences returns the other (same package) structs that n's fields
+// contain by value, either directly or as array elements. Those behind a
+// pointer or a slice are not contained by value. The type arguments of a
+// generic struct, such as the "foo" in "ring_buffer[foo]", are conservatively
+// assumed to be contained by value.
+func (c *Checker) structReferences(n *a.Struct) []*a.Struct {
+	typs := []*a.TypeExpr(nil)
+	for _, o := range n.Fields() {
+		typs = append(typs, o.Field().XType())
+	}
+	return c.typeReferences(typs)
+}
+
+// typeReferences returns the (same package) structs that values of the given
+// types contain by value, as per structReferences.
+func (c *Checker) typeReferences(typs []*a.TypeExpr) []*a.Struct {
+	ret := []*a.Struct(nil)
+	seen := map[*a.Struct]bool{}
+	for len(typs) > 0 {
+		typ := typs[0]
+		typs = typs[1:]
+		for typ.Decorator().Key() == t.KeyOpenBracket {
+			typ = typ.Inner()
+		}
+		if typ.Decorator() != 0 {
+			continue
+		}
+		for _, o := range typ.TypeArgs() {
+			typs = append(typs, o.TypeExpr())
+		}
+		if s, ok := c.structs[typ.QID()]; ok && !seen[s] {
+			seen[s] = true
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
 func (c *Checker) checkStructFields(node *a.Node) error {
 	n := node.Struct()
-	if err := c.checkFields(n.Fields(), true); err != nil {
+	if err := c.checkTypeParams(n.QID()[0], n.TypeParams(), node); err != nil {
+		return &Error{
+			Err:      fmt.Errorf("%v in struct %s", err, n.QID().Str(c.tm)),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	typeParams := newTypeParamMap(n.QID()[0], n.TypeParams())
+	if err := c.checkFields(n.Fields(), typeParams, true, false); err != nil {
 		return &Error{
 			Err:      fmt.Errorf("%v in struct %s", err, n.QID().Str(c.tm)),
 			Filename: n.Filename(),
@@ -412,14 +768,21 @@ func (c *Checker) checkStructFields(node *a.Node) error {
 	return nil
 }
 
-func (c *Checker) checkFields(fields []*a.Node, banPtrTypes bool) error {
+// checkFields checks struct fields or function params, whose types can refer
+// to the typeParams of a generic struct or func. inParams is whether the
+// fields are a function's in-params, which have two rules of their own. Only
+// in-params can be marked "var", as struct fields and out-params can always be
+// assigned to. Only in-params can omit a default value that is within a
+// refined type's bounds, as the caller must then pass an argument.
+func (c *Checker) checkFields(fields []*a.Node, typeParams typeParamMap, banPtrTypes bool, inParams bool) error {
 	if len(fields) == 0 {
 		return nil
 	}
 
 	q := &checker{
-		c:  c,
-		tm: c.tm,
+		c:          c,
+		tm:         c.tm,
+		typeParams: typeParams,
 	}
 	fieldNames := map[t.ID]bool{}
 	for _, n := range fields {
@@ -430,6 +793,9 @@ func (c *Checker) checkFields(fields []*a.Node, banPtrTypes bool) error {
 		if err := q.tcheckTypeExpr(f.XType(), 0); err != nil {
 			return fmt.Errorf("%v in field %q", err, f.Name().Str(c.tm))
 		}
+		if f.Mutable() && !inParams {
+			return fmt.Errorf("check: field %q cannot be marked \"var\"", f.Name().Str(c.tm))
+		}
 		if banPtrTypes && f.XType().HasPointers() {
 			return fmt.Errorf("check: pointer-containing type %q not allowed for field %q",
 				f.XType().Str(c.tm), f.Name().Str(c.tm))
@@ -442,8 +808,15 @@ func (c *Checker) checkFields(fields []*a.Node, banPtrTypes bool) error {
 			if err := q.tcheckExpr(dv, 0); err != nil {
 				return err
 			}
+			if dv.ConstValue() == nil {
+				return fmt.Errorf("check: default value %q is not constant for field %q",
+					dv.Str(c.tm), f.Name().Str(c.tm))
+			}
+			if err := q.tcheckEq(f.Name(), nil, f.XType(), dv, dv.MType()); err != nil {
+				return err
+			}
 		}
-		if err := bcheckField(c.tm, f); err != nil {
+		if err := bcheckField(c.tm, f, inParams); err != nil {
 			return err
 		}
 		fieldNames[f.Name()] = true
@@ -455,7 +828,15 @@ func (c *Checker) checkFields(fields []*a.Node, banPtrTypes bool) error {
 
 func (c *Checker) checkFuncSignature(node *a.Node) error {
 	n := node.Func()
-	if err := c.checkFields(n.In().Fields(), false); err != nil {
+	if err := c.checkTypeParams(n.Receiver()[0], n.TypeParams(), node); err != nil {
+		return &Error{
+			Err:      fmt.Errorf("%v in func %s", err, n.QQID().Str(c.tm)),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	typeParams := newTypeParamMap(n.Receiver()[0], n.TypeParams())
+	if err := c.checkFields(n.In().Fields(), typeParams, false, true); err != nil {
 		return &Error{
 			Err:      fmt.Errorf("%v in in-params for func %s", err, n.QQID().Str(c.tm)),
 			Filename: n.Filename(),
@@ -463,7 +844,7 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 		}
 	}
 	n.In().Node().SetTypeChecked()
-	if err := c.checkFields(n.Out().Fields(), false); err != nil {
+	if err := c.checkFields(n.Out().Fields(), typeParams, false, false); err != nil {
 		return &Error{
 			Err:      fmt.Errorf("%v in out-params for func %s", err, n.QQID().Str(c.tm)),
 			Filename: n.Filename(),
@@ -477,6 +858,13 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 	// implicit "return out"?
 
 	qqid := n.QQID()
+	if _, ok := builtin.NumFuncs[qqid.Str(c.tm)]; ok {
+		return &Error{
+			Err:      fmt.Errorf("check: function %s has the same name as a built-in function", qqid.Str(c.tm)),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
 	if other, ok := c.funcs[qqid]; ok {
 		return &Error{
 			Err:           fmt.Errorf("check: duplicate function %s", qqid.Str(c.tm)),
@@ -493,10 +881,9 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 	oQID := n.Out().QID()
 	outTyp := a.NewTypeExpr(0, oQID[0], oQID[1], nil, nil, nil)
 	outTyp.Node().SetTypeChecked()
-	localVars := typeMap{
-		t.IDIn:  inTyp,
-		t.IDOut: outTyp,
-	}
+	scope := NewScope()
+	scope.Declare(t.IDIn, inTyp)
+	scope.Declare(t.IDOut, outTyp)
 	if qqid[1] != 0 {
 		if _, ok := c.structs[t.QID{qqid[0], qqid[1]}]; !ok {
 			return &Error{
@@ -509,10 +896,10 @@ func (c *Checker) checkFuncSignature(node *a.Node) error {
 		sTyp.Node().SetTypeChecked()
 		pTyp := a.NewTypeExpr(t.IDPtr, 0, 0, nil, nil, sTyp)
 		pTyp.Node().SetTypeChecked()
-		localVars[t.IDThis] = pTyp
+		scope.Declare(t.IDThis, pTyp)
 	}
 	c.funcs[qqid] = n
-	c.localVars[qqid] = localVars
+	c.scopes[qqid] = scope
 	return nil
 }
 
@@ -522,28 +909,81 @@ func (c *Checker) checkFuncContract(node *a.Node) error {
 		return nil
 	}
 	q := &checker{
-		c:  c,
-		tm: c.tm,
+		c:          c,
+		tm:         c.tm,
+		astFunc:    c.funcs[n.QQID()],
+		scope:      c.scopes[n.QQID()],
+		typeParams: newTypeParamMap(n.Receiver()[0], n.TypeParams()),
+	}
+	locals := map[t.ID]bool{}
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if o.Kind() == a.KVar {
+				locals[o.Var().Name()] = true
+			}
+			return nil
+		})
 	}
 	for _, o := range n.Asserts() {
-		if err := q.tcheckAssert(o.Assert()); err != nil {
+		if err := q.checkContractNames(o.Assert(), locals); err != nil {
+			return &Error{
+				Err:      err,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		q.inFuncPost = o.Assert().Keyword().Key() == t.KeyPost
+		err := q.tcheckAssert(o.Assert())
+		q.inFuncPost = false
+		if err != nil {
 			return err
 		}
+		o.SetTypeChecked()
 	}
 	return nil
 }
 
+// checkContractNames checks the names that a function's pre or post condition
+// n refers to. A pre condition has to be expressible at the call site, so it
+// can refer to in-parameters, the receiver and consts, but not to
+// out-parameters or to local variables, the names of which are the keys of
+// locals. A post condition can also refer to out-parameters.
+func (q *checker) checkContractNames(n *a.Assert, locals map[t.ID]bool) error {
+	keyword := n.Keyword().Key()
+	return n.Node().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.Expr()
+		if x.Operator() != 0 || !x.Ident().IsIdent() {
+			return nil
+		}
+		name := x.Ident()
+		if locals[name] {
+			return fmt.Errorf("check: %s condition %q refers to the local variable %q",
+				n.Keyword().Str(q.tm), n.Condition().Str(q.tm), name.Str(q.tm))
+		}
+		if name.Key() == t.KeyOut && keyword == t.KeyPre {
+			return fmt.Errorf("check: pre condition %q refers to the out-parameters; "+
+				"a pre condition can only refer to in-parameters and consts", n.Condition().Str(q.tm))
+		}
+		return nil
+	})
+}
+
 func (c *Checker) checkFuncBody(node *a.Node) error {
 	n := node.Func()
 	q := &checker{
-		c:         c,
-		tm:        c.tm,
-		reasonMap: c.reasonMap,
-		astFunc:   c.funcs[n.QQID()],
-		localVars: c.localVars[n.QQID()],
+		c:          c,
+		tm:         c.tm,
+		reasonMap:  c.reasonMap,
+		astFunc:    c.funcs[n.QQID()],
+		scope:      c.scopes[n.QQID()],
+		typeParams: newTypeParamMap(n.Receiver()[0], n.TypeParams()),
 	}
+	c.funcSafety(n)
 
-	// Fill in the TypeMap with all local variables. Note that they have
+	// Fill in the function's scope with all local variables. Note that they have
 	// function scope and can be hoisted, JavaScript style, a la
 	// https://developer.mozilla.org/en/docs/Web/JavaScript/Reference/Statements/var
 	if err := q.tcheckVars(n.Body()); err != nil {
@@ -567,6 +1007,14 @@ func (c *Checker) checkFuncBody(node *a.Node) error {
 		}
 	}
 
+	if err := q.checkOutsAssigned(n); err != nil {
+		return &Error{
+			Err:      err,
+			Filename: q.errFilename,
+			Line:     q.errLine,
+		}
+	}
+
 	if err := q.bcheckBlock(n.Body()); err != nil {
 		return &Error{
 			Err:      err,
@@ -577,6 +1025,14 @@ func (c *Checker) checkFuncBody(node *a.Node) error {
 		}
 	}
 
+	if err := q.checkBufferSlices(n); err != nil {
+		return &Error{
+			Err:      err,
+			Filename: q.errFilename,
+			Line:     q.errLine,
+		}
+	}
+
 	n.Node().SetTypeChecked()
 	if err := n.Node().Walk(func(o *a.Node) error {
 		if !o.TypeChecked() {
@@ -621,17 +1077,70 @@ func (c *Checker) checkFieldMethodCollisions(node *a.Node) error {
 	return nil
 }
 
+// checkStructSuspendible checks that a struct is marked suspendible, with a
+// "?", if and only if it has suspendible methods. Such methods save their
+// state, across suspensions, in a suspendible struct's fields.
+func (c *Checker) checkStructSuspendible(node *a.Node) error {
+	n := node.Struct()
+	qid := n.QID()
+	methods := []string(nil)
+	for qqid, f := range c.funcs {
+		if qqid[0] == qid[0] && qqid[1] == qid[1] && f.Suspendible() {
+			methods = append(methods, qqid[2].Str(c.tm))
+		}
+	}
+	sort.Strings(methods)
+
+	if !n.Suspendible() && len(methods) > 0 {
+		return &Error{
+			Err: fmt.Errorf("check: struct %s is not suspendible but has suspendible method %q",
+				qid.Str(c.tm), methods[0]),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	if n.Suspendible() && len(methods) == 0 {
+		c.warnf(n.Filename(), n.Line(), WarningUnusedSuspendible,
+			"struct %s is suspendible but has no suspendible methods", qid.Str(c.tm))
+	}
+	return nil
+}
+
 type checker struct {
 	c         *Checker
 	tm        *t.Map
 	reasonMap reasonMap
 	astFunc   *a.Func
-	localVars typeMap
+	scope     *Scope
+
+	// typeParams are the type parameters of the generic struct or func being
+	// checked, if any.
+	typeParams typeParamMap
 
 	errFilename string
 	errLine     uint32
 
 	jumpTargets []a.Loop
+	usedLabels  map[a.Loop]bool
+
+	// inAssert is whether an assert, pre, post or inv condition is being type
+	// checked. Such conditions are proof obligations for the bounds checker,
+	// not run-time tests, so they are not folded even if they are constant.
+	inAssert bool
+
+	// inFuncPost is whether a function's post condition is being type
+	// checked, where "result" names the function's sole out-param.
+	inFuncPost bool
+
+	// inCondition is whether an if or while condition, or an iterate
+	// variable's range, is being type checked.
+	inCondition bool
+
+	// strLiteral is the string literal, if any, that is about to be type
+	// checked in one of the places where cgen can emit it: initializing a
+	// "[N] u8" array, or as the receiver of ".length()". A string literal
+	// anywhere else is an error.
+	strLiteral *a.Expr
 
 	facts facts
 }
@@ -112,7 +112,7 @@ func TestCheck(tt *testing.T) {
 		tt.Fatalf("compareToWuffsfmt: %v", err)
 	}
 
-	c, err := Check(tm, []*a.File{file}, nil)
+	c, err := Check(tm, []*a.File{file}, nil, nil)
 	if err != nil {
 		tt.Fatalf("Check: %v", err)
 	}
@@ -126,8 +126,8 @@ func TestCheck(tt *testing.T) {
 		fooBar = f
 		break
 	}
-	for _, v := range c.localVars {
-		fooBarLocalVars = v
+	for _, v := range c.scopes {
+		fooBarLocalVars = v.Vars()
 		break
 	}
 
@@ -213,7 +213,7 @@ func TestConstValues(tt *testing.T) {
 			continue
 		}
 
-		c, err := Check(tm, []*a.File{file}, nil)
+		c, err := Check(tm, []*a.File{file}, nil, nil)
 		if err != nil {
 			tt.Errorf("%q: Check: %v", s, err)
 			continue
@@ -247,6 +247,1897 @@ func TestConstValues(tt *testing.T) {
 	}
 }
 
+func checkFuncBody(tm *t.Map, body string) (*Checker, error) {
+	return checkSource(tm, "pri func foo()() {\n"+body+"\n}\n")
+}
+
+func checkSource(tm *t.Map, decls string) (*Checker, error) {
+	return checkSourceWithOptions(tm, decls, nil)
+}
+
+// checkSourceWithOptions is like checkSourceAllWarnings, but it hides
+// WarningUnreachableFunc, as most tests' private funcs are never called.
+func checkSourceWithOptions(tm *t.Map, decls string, opts *Options) (*Checker, error) {
+	c, err := checkSourceAllWarnings(tm, decls, opts)
+	if c != nil {
+		c.AllowWarning(WarningUnreachableFunc)
+	}
+	return c, err
+}
+
+func checkSourceAllWarnings(tm *t.Map, decls string, opts *Options) (*Checker, error) {
+	const filename = "test.wuffs"
+	src := "packageid \"test\"\n" + decls
+	tokens, comments, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		return nil, fmt.Errorf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, &parse.Options{
+		Comments: comments,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Parse: %v", err)
+	}
+	return Check(tm, []*a.File{file}, nil, opts)
+}
+
+func TestUnsignedArrayLengthsAndIndexes(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"var a[4] u8", ""},
+		{"var a[0x10] u8", ""},
+		{"var a[-1] u8", "array length must be unsigned"},
+		{"var a[4] u8\nvar i u32[..3]\nvar x u8 = a[i]", ""},
+		{"var a[4] u8\nvar x u8 = a[3]", ""},
+		{"var a[4] u8\nvar i i32[0..3]\nvar x u8 = a[i]", ""},
+		{"var a[4] u8\nvar i i32\nvar x u8 = a[i]", "array index must be unsigned"},
+		{"var a[4] u8\nvar i i32[-1..3]\nvar x u8 = a[i]", "array index must be unsigned"},
+	}
+
+	tm := &t.Map{}
+	for _, tc := range testCases {
+		_, err := checkFuncBody(tm, tc.body)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestDefaultArgs(tt *testing.T) {
+	const decls = `
+		pri struct s(
+			i u32,
+		)
+
+		pri func s.bar!(x u32, y u32[..100] = 7)() {
+			this.i = in.y
+		}
+	`
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{decls + "pri func s.foo()() {\nthis.bar!(x:1)\nthis.bar!(x:1, y:2)\n}\n", ""},
+		{decls + "pri func s.foo()() {\nthis.bar!(y:2)\n}\n", `missing argument "x"`},
+		{decls + "pri func s.foo()() {\nthis.bar!(x:1, y:2, y:3)\n}\n", "arguments but 3 were given"},
+		{"pri func baz(x u8 = 300)() {\n}\n", "not within bounds"},
+		{"pri func baz(x u8[10..20] = 10, y u8[10..20] = 20)() {\n}\n", ""},
+		{"pri func baz(x u8[10..20])() {\n}\n", ""},
+		{"pri func baz(x u8[10..20] = 5)() {\n}\n",
+			`default value 5 is not within bounds [10..20], of type "u8[10..20]", for in-param "x"`},
+		{"pri func baz(x u8[10..20] = 21)() {\n}\n",
+			`default value 21 is not within bounds [10..20], of type "u8[10..20]", for in-param "x"`},
+		{"pri struct t(x u8[10..20])\n", `default value 0 is not within bounds [10..20] for field "x"`},
+		{"pri func baz(x u8 = true)() {\n}\n", "cannot assign"},
+	}
+
+	for _, tc := range testCases {
+		c, err := checkSource(&t.Map{}, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			continue
+		}
+
+		// Both calls should have had their y argument filled in, with a copy
+		// of the default value, not the callee's own node.
+		dv := (*a.Expr)(nil)
+		for _, f := range c.funcs {
+			if f.FuncName().Str(c.tm) == "bar" {
+				dv = f.In().Fields()[1].Field().DefaultValue()
+			}
+		}
+		for _, f := range c.funcs {
+			if f.FuncName().Str(c.tm) != "foo" {
+				continue
+			}
+			for i, o := range f.Body() {
+				args := o.Expr().Args()
+				if len(args) != 2 {
+					tt.Errorf("call #%d: got %d args, want 2", i, len(args))
+					continue
+				}
+				want := int64(7)
+				if i == 1 {
+					want = 2
+				}
+				if got := args[1].Arg().Value().ConstValue(); got == nil || got.Int64() != want {
+					tt.Errorf("call #%d: y: got %v, want %d", i, got, want)
+				}
+				if args[1].Arg().Value() == dv {
+					tt.Errorf("call #%d: y: got the callee's default value node, want a copy", i)
+				}
+			}
+		}
+	}
+}
+
+func TestInferredVarTypes(tt *testing.T) {
+	testCases := []struct {
+		body     string
+		wantType string
+		wantErr  string
+	}{
+		{"var x u32\nvar y = x", "u32", ""},
+		{"var x u32[..10]\nvar y = x + 1", "u32", ""},
+		{"var x u8\nvar y = x as u64", "u64", ""},
+		{"var y = 1 + 2", "", "from the ideal constant"},
+		{"var y = x\nvar x u32", "", "unrecognized identifier"},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkFuncBody(tm, tc.body)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			continue
+		}
+		for _, v := range c.scopes {
+			if got := v.Vars()[tm.ByName("y")].Str(tm); got != tc.wantType {
+				tt.Errorf("%q: got %q, want %q", tc.body, got, tc.wantType)
+			}
+		}
+	}
+
+	// A var without an explicit type must have an initializer. The parser
+	// rejects this before the checker sees it.
+	tm := &t.Map{}
+	if _, err := checkFuncBody(tm, "var y"); err == nil {
+		tt.Errorf("var y: got nil error, want non-nil")
+	}
+}
+
+func TestAssertFlattensAssociativeOps(tt *testing.T) {
+	const src = `
+		pri func foo(a u32[..10], b u32[..10], c u32[..10])() {
+			if ((in.a + in.b) + in.c) < 20 {
+				assert (in.a + (in.b + in.c)) < 20
+				assert (in.a + in.b + in.c) < 20
+			}
+		}
+	`
+	if _, err := checkSource(&t.Map{}, src); err != nil {
+		tt.Fatalf("got %v, want nil error", err)
+	}
+}
+
+func TestWarnings(tt *testing.T) {
+	const body = `
+		var x u32
+		var y u32 = x as u32
+		var z u64 = x as u64
+	`
+	tm := &t.Map{}
+	c, err := checkFuncBody(tm, body)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	ws := c.Warnings()
+	if len(ws) != 1 {
+		tt.Fatalf("Warnings: got %d elements, want 1", len(ws))
+	}
+	if got, want := ws[0].Category, WarningRedundantConversion; got != want {
+		tt.Fatalf("Category: got %q, want %q", got, want)
+	}
+	if got, want := ws[0].Line, uint32(5); got != want {
+		tt.Fatalf("Line: got %d, want %d", got, want)
+	}
+
+	if err := c.Err(); err != nil {
+		tt.Fatalf("Err: got %v, want nil", err)
+	}
+	c.SetWarningsAsErrors(true)
+	if err := c.Err(); err == nil {
+		tt.Fatalf("Err: got nil, want non-nil")
+	} else if _, ok := err.(*Error); !ok {
+		tt.Fatalf("Err: got %T, want *Error", err)
+	}
+
+	c.AllowWarning(WarningRedundantConversion)
+	if got := len(c.Warnings()); got != 0 {
+		tt.Fatalf("Warnings: got %d elements, want 0", got)
+	}
+	if err := c.Err(); err != nil {
+		tt.Fatalf("Err: got %v, want nil", err)
+	}
+}
+
+func TestNoWarn(tt *testing.T) {
+	const body = `
+		var x u32
+		// wuffs:nowarn redundant-conversion
+		var y u32 = x as u32
+		var z u32 = x as u32
+
+		// Some other comment.
+		// wuffs:nowarn redundant-conversion
+		var w u64 = x as u64
+	`
+	c, err := checkFuncBody(&t.Map{}, body)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	got := []string(nil)
+	for _, w := range c.Warnings() {
+		got = append(got, fmt.Sprintf("%d %s", w.Line, w.Category))
+	}
+	want := []string{
+		"7 redundant-conversion",
+		"11 unused-nowarn",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestStructSuspendible(tt *testing.T) {
+	testCases := []struct {
+		src      string
+		wantErr  string
+		wantWarn string
+	}{
+		{"pub struct foo?()\npub func foo.bar?()() {\n}\n", "", ""},
+		{"pub struct foo()\npub func foo.bar!()() {\n}\n", "", ""},
+		{"pub struct foo()\npub func foo.bar?()() {\n}\n", "is not suspendible", ""},
+		{"pub struct foo?()\npub func foo.bar!()() {\n}\n", "", "2 unused-suspendible"},
+		{"// wuffs:nowarn unused-suspendible\npub struct foo?()\n", "", ""},
+		{"@[if true]\npub struct foo?()\n", "", "3 unused-suspendible"},
+		{"// wuffs:nowarn unused-suspendible\n@[if true]\npub struct foo?()\n", "", ""},
+		{"@[if true]\n// wuffs:nowarn unused-suspendible\npub struct foo?()\n", "", ""},
+	}
+
+	for _, tc := range testCases {
+		c, err := checkSource(&t.Map{}, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			continue
+		}
+		got := ""
+		for _, w := range c.Warnings() {
+			got += fmt.Sprintf("%d %s", w.Line, w.Category)
+		}
+		if got != tc.wantWarn {
+			tt.Errorf("%q: warnings: got %q, want %q", tc.src, got, tc.wantWarn)
+		}
+	}
+}
+
+func TestLabels(tt *testing.T) {
+	const body = `
+		var i u32
+		while:outer i < 10 {
+			while:inner i < 5 {
+				i += 1
+				break
+			}
+			while:used i < 5 {
+				i += 1
+				continue:used
+			}
+			break:outer
+		}
+	`
+	c, err := checkFuncBody(&t.Map{}, body)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	got := []string(nil)
+	for _, w := range c.Warnings() {
+		got = append(got, fmt.Sprintf("%d %s", w.Line, w.Category))
+	}
+	want := []string{
+		"6 unused-label",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+
+	const undefined = `
+		while:outer true {
+			break:inner
+		}
+	`
+	if _, err := checkFuncBody(&t.Map{}, undefined); err == nil ||
+		!strings.Contains(err.Error(), "no matching while/iterate statement for break:inner") {
+		tt.Fatalf("got %v, want error for the undefined label", err)
+	}
+}
+
+func TestFloatLiterals(tt *testing.T) {
+	testCases := []struct {
+		stmt    string
+		wantErr string
+	}{
+		{"var x u32 = 3", ""},
+		{"var x u32 = 0xE5", ""},
+		{"var x u32[0..9] = 5", ""},
+		{"var x u32 = 3.14", `floating-point literal "3.14" is not yet supported`},
+		{"var x u32 = 6.02e23", `floating-point literal "6.02e23" is not yet supported`},
+		{"var x u32 = 1e-3", `floating-point literal "1e-3" is not yet supported`},
+	}
+
+	for _, tc := range testCases {
+		_, err := checkFuncBody(&t.Map{}, tc.stmt)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+		}
+	}
+}
+
+func TestUnusedExpressions(tt *testing.T) {
+	testCases := []struct {
+		stmt    string
+		wantErr bool
+	}{
+		{"this.bar!()", false},
+		{"this.baz?()", false},
+		{"in.x", true},
+		{"in.x + 1", true},
+		{"(in.x + 1)", true},
+		{"min(a:in.x, b:1)", true},
+		{"this.qux()", true},
+		{"in.x.low_bits(n:3)", true},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct s?()\n" +
+			"pri func s.bar!()() {\n}\n" +
+			"pri func s.baz?()() {\n}\n" +
+			"pri func s.qux()() {\n}\n" +
+			"pri func s.foo?(x u32)() {\n\t" + tc.stmt + "\n}\n"
+		_, err := checkSource(&t.Map{}, src)
+		if !tc.wantErr {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), "expression result is unused") {
+			tt.Errorf("%q: got %v, want an unused expression result error", tc.stmt, err)
+		}
+	}
+}
+
+func TestBuildTags(tt *testing.T) {
+	const src = `
+		@[if target == "wasm"]
+		pri const n u32 = 1
+
+		@[if target != "wasm"]
+		pri const n u32 = 2
+
+		@[if (target == "x86") and not (os == "linux")]
+		pri const m u32 = 3
+	`
+	testCases := []struct {
+		buildTags map[string]string
+		wantN     string
+		wantM     string
+		wantErr   string
+	}{
+		{map[string]string{"target": "wasm", "os": "linux"}, "1", "", ""},
+		{map[string]string{"target": "x86", "os": "linux"}, "2", "", ""},
+		{map[string]string{"target": "x86", "os": "darwin"}, "2", "3", ""},
+		{map[string]string{"target": "wasm"}, "", "", `unknown build tag "os"`},
+		{nil, "", "", `unknown build tag "target"`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkSourceWithOptions(tm, src, &Options{BuildTags: tc.buildTags})
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%v: got %v, want error containing %q", tc.buildTags, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%v: got %v, want nil error", tc.buildTags, err)
+			continue
+		}
+		for _, x := range [...]struct{ name, want string }{{"n", tc.wantN}, {"m", tc.wantM}} {
+			got := ""
+			if k, ok := c.consts[t.QID{0, tm.ByName(x.name)}]; ok {
+				got = k.Value().ConstValue().String()
+			}
+			if got != x.want {
+				tt.Errorf("%v: const %s: got %q, want %q", tc.buildTags, x.name, got, x.want)
+			}
+		}
+	}
+}
+
+func TestOutsAssigned(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"out.x = 1\nout.y = 2\nreturn", ""},
+		{"out.x = 1\nout.y = 2", ""},
+		{"out.x = 1\nreturn", `out-parameter "y" is not assigned before return`},
+		{"if in.c {\nout.x = 1\n} else {\nout.x = 2\n}\nout.y = 3", ""},
+		{"if in.c {\nout.x = 1\n}\nout.y = 3",
+			`out-parameter "x" is not assigned before the end of the function`},
+		{"if in.c {\nout.x = 1\nout.y = 1\nreturn\n}\nout.x = 2\nout.y = 2", ""},
+		{"if in.c {\nout.x = 1\nreturn\n}\nout.x = 2\nout.y = 2",
+			`out-parameter "y" is not assigned before return`},
+		{"while in.c {\nout.x = 1\nout.y = 1\nbreak\n}",
+			`out-parameter "x" is not assigned before the end of the function`},
+		{"while true {\nout.x = 1\nout.y = 1\nreturn\n}", ""},
+		{"while true {\nout.x = 1\nif in.c {\nbreak\n}\nout.y = 1\nreturn\n}",
+			`out-parameter "y" is not assigned before the end of the function`},
+		{"while true {\nout.x = 1\nif in.c {\nout.y = 1\nbreak\n}\n}", ""},
+		{"while true {\nout.x = 1\nbreak\n}\nout.y = 2", ""},
+		{"while:l true {\nout.x = 1\nwhile true {\nout.y = 1\nbreak:l\n}\n}", ""},
+		{"while:l true {\nout.x = 1\nwhile true {\nbreak\n}\nout.y = 1\nbreak:l\n}", ""},
+		{"while true {\nwhile true {\nout.x = 1\nout.y = 1\nbreak\n}\nbreak\n}", ""},
+		{"while true {\nwhile in.c {\nout.x = 1\nout.y = 1\nbreak\n}\nbreak\n}",
+			`out-parameter "x" is not assigned before the end of the function`},
+		{"return 7", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(c bool)(x u32, y u32) {\n" + tc.body + "\n}\n"
+		_, err := checkSource(&t.Map{}, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSafetyReport(tt *testing.T) {
+	const src = `
+pri struct s()
+
+pri func s.bar!(x u32)(), pre true {
+}
+
+pri func s.foo(i u32[..3], d u32[1..10] = 1)() {
+	var a[4] u8
+	var x u8 = a[in.i]
+	var y u32 = in.i % in.d
+	var b[] u8 = a[:]
+	this.bar!(x:in.d)
+}
+`
+	tm := &t.Map{}
+	c, err := checkSource(tm, src)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	got := []string(nil)
+	for _, s := range c.SafetyReport() {
+		got = append(got, fmt.Sprintf("%s:%d proven=%v unproven=%v",
+			s.Func.Str(tm), s.Line, s.Proven, s.Unproven))
+	}
+	want := []string{
+		"s.bar:5 proven=[0 0 0 0 0] unproven=[0 0 0 0 0]",
+		"s.foo:8 proven=[1 3 1 1 0] unproven=[0 0 0 0 0]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestAssumeInBounds(tt *testing.T) {
+	const prefix = "pri struct s?()\npri func s.f?(x u32, y u8[10..20] = 10)() {\n\tvar i u32[..15]\n"
+	testCases := []struct {
+		body        string
+		wantProven  int
+		wantRuntime int
+		wantErr     string
+	}{
+		{"\ti = assume_in_bounds(x:in.x, lo:0, hi:15)\n", 0, 1, ""},
+		{"\ti = assume_in_bounds(x:in.x, lo:3, hi:7)\n", 0, 1, ""},
+		{"\ti = assume_in_bounds(x:in.x & 7, lo:0, hi:15)\n", 1, 0, ""},
+		{"\tif in.x < 10 {\n\t\ti = assume_in_bounds(x:in.x, lo:0, hi:15)\n\t}\n", 1, 0, ""},
+		{"\ti = assume_in_bounds(x:in.x, lo:0, hi:16)\n", 0, 0, `bounds [0..16] is not within bounds [0..15]`},
+		{"\ti = assume_in_bounds(x:in.y as u32, lo:0, hi:5)\n", 0, 0,
+			`"in.y as u32", in the range [10..20], can never be within the range [0..5]`},
+		{"\tif in.x > 100 {\n\t\ti = assume_in_bounds(x:in.x, lo:0, hi:15)\n\t}\n", 0, 0,
+			`"in.x", in the range [101..4294967295], can never be within the range [0..15]`},
+		{"\ti = assume_in_bounds(x:in.x, lo:in.x, hi:15)\n", 0, 0, `argument "in.x" is not constant`},
+		{"\ti = assume_in_bounds(x:in.x, lo:7, hi:3)\n", 0, 0, `range [7..3] is empty`},
+		{"\ti = assume_in_bounds(x:3, lo:0, hi:15)\n", 0, 0, `has an ideal number type`},
+		{"\ti = (assume_in_bounds(x:in.y, lo:0, hi:300) as u32)\n", 0, 0,
+			`range [0..300] is not within the bounds [0..255] of type "u8"`},
+		{"\tif assume_in_bounds(x:in.x, lo:0, hi:15) < 3 {\n\t}\n", 0, 0,
+			`assume_in_bounds call "assume_in_bounds(x:in.x, lo:0, hi:15)" is not allowed in a condition`},
+		{"\twhile assume_in_bounds(x:in.x, lo:0, hi:15) < 3 {\n\t}\n", 0, 0,
+			`is not allowed in a condition`},
+	}
+
+	for _, tc := range testCases {
+		src := prefix + tc.body + "}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			continue
+		}
+		for _, s := range c.SafetyReport() {
+			if got := s.Proven[ObligationRange]; got != tc.wantProven {
+				tt.Errorf("%q: proven: got %d, want %d", tc.body, got, tc.wantProven)
+			}
+			if got := s.RuntimeChecked[ObligationRange]; got != tc.wantRuntime {
+				tt.Errorf("%q: runtime-checked: got %d, want %d", tc.body, got, tc.wantRuntime)
+			}
+		}
+	}
+
+	const pure = "pri struct s()\npri func s.f(x u32)() {\n\tvar i u32[..15] = assume_in_bounds(x:in.x, lo:0, hi:15)\n}\n"
+	const wantErr = "is not allowed in a non-suspendible function"
+	if _, err := checkSource(&t.Map{}, pure); err == nil || !strings.Contains(err.Error(), wantErr) {
+		tt.Errorf("pure func: got %v, want error containing %q", err, wantErr)
+	}
+}
+
+func TestContractNames(tt *testing.T) {
+	testCases := []struct {
+		contract string
+		wantErr  string
+	}{
+		{"pre in.x < 10", ""},
+		{"pre in.x < c", ""},
+		{"pre this.n < 3", ""},
+		{"post out.y < 10", ""},
+		{"post out.y <= in.x", ""},
+		{"pre out.y < 10", `pre condition "out.y < 10" refers to the out-parameters`},
+		{"pre z < 10", `pre condition "z < 10" refers to the local variable "z"`},
+		{"post z < 10", `post condition "z < 10" refers to the local variable "z"`},
+		{"pre in.x < 10 via \"a < b: a < c; c <= b\"(c:z)", `refers to the local variable "z"`},
+		{"post result <= in.limit", `no field or method named "limit"`},
+		{"post result <= in.x", ""},
+		{"post result <= c, post result == out.y", ""},
+		{"pre result < 10", `"result" can only be used in a function's post condition`},
+		{"post result", `assert condition "result", of type "u32", does not have a boolean type`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri const c u32 = 3\npri struct s(n u32)\n" +
+			"pri func s.bar(x u32)(y u32), " + tc.contract + " {\n\tvar z u32\n\treturn z\n}\n"
+		tm := &t.Map{}
+		_, err := checkSource(tm, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.contract, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.contract, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPostResult(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri func f(x u32)(y u32[..9]), post result < 10 {\n}\n", ""},
+		{"pri func f(x u32)(a u32, b u32), post result < 10 {\n}\n",
+			`"result" needs func f to have exactly one out-param, but it has 2`},
+		{"pri func f(x u32)(), post result < 10 {\n}\n",
+			`"result" needs func f to have exactly one out-param, but it has 0`},
+		{"pri func f(x u32)(y u32) {\n\tvar z u32 = result\n}\n",
+			`"result" can only be used in a function's post condition`},
+		{"pri func f(x u32)(y u32) {\n\tvar result u32\n\tvar z u32 = result\n}\n", ""},
+	}
+
+	for _, tc := range testCases {
+		c, err := checkSource(&t.Map{}, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			for _, o := range f.Asserts() {
+				lhs := o.Assert().Condition().LHS().Expr()
+				if got, want := lhs.MType().Str(c.tm), "u32[..9]"; got != want {
+					tt.Errorf("%q: type of %q: got %q, want %q", tc.src, lhs.Str(c.tm), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestInferLoopInvariant(tt *testing.T) {
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		// The inferred "i <= 10" proves the assert after the loop.
+		{"\twhile i < 10 {\n\t\ta[i] = 0\n\t\ti += 1\n\t}\n\tassert i <= 10\n", ""},
+		{"\ti = 3\n\twhile i < 10 {\n\t\ti += 1\n\t}\n\tassert i <= 10\n", ""},
+		// No invariant is inferred if i can start above the limit, if the
+		// increment isn't the final statement, if i is otherwise modified or if
+		// a continue can skip the increment.
+		{"\ti = 12\n\twhile i < 10 {\n\t\ti += 1\n\t}\n\tassert i <= 10\n", `cannot prove "i <= 10"`},
+		{"\twhile i < 10 {\n\t\ti += 1\n\t\ta[0] = 0\n\t}\n\tassert i <= 10\n", `cannot prove "i <= 10"`},
+		{"\twhile i < 10 {\n\t\ti = 0\n\t\ti += 1\n\t}\n\tassert i <= 10\n", `cannot prove "i <= 10"`},
+		{"\twhile i < 10 {\n\t\tif a[0] == 0 {\n\t\t\tcontinue\n\t\t}\n\t\ti += 1\n\t}\n\tassert i <= 10\n",
+			`cannot prove "i <= 10"`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri struct s()\npri func s.f()() {\n\tvar a[10] u8\n\tvar i u32\n" + tc.body + "}\n"
+		tm := &t.Map{}
+		_, err := checkSource(tm, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestMalformedOperatorFlags(tt *testing.T) {
+	tm := &t.Map{}
+	x, err := tm.Insert("x")
+	if err != nil {
+		tt.Fatalf("Insert: %v", err)
+	}
+	xe := func() *a.Node { return a.NewExpr(0, 0, 0, x, nil, nil, nil, nil).Node() }
+
+	// A binary plus whose token.ID also claims to be unary, as if from a bug
+	// in the token table.
+	bad := t.IDXBinaryPlus | t.ID(t.FlagsUnaryOp)
+	n := a.NewExpr(0, bad, 0, 0, xe(), nil, xe(), nil)
+	q := &checker{c: &Checker{tm: tm}, tm: tm}
+
+	const want = `check: operator "+" (token.Key 0x%02X) has inconsistent flags 0x0006 for %s; ` +
+		`want exactly one of unary (0x0002), binary (0x0004) or associative (0x0008)`
+	if err := q.tcheckExpr(n, 0); err == nil {
+		tt.Errorf("tcheckExpr: got nil error, want non-nil")
+	} else if got, want := err.Error(), fmt.Sprintf(want, bad.Key(), "tcheckExpr"); got != want {
+		tt.Errorf("tcheckExpr:\ngot  %s\nwant %s", got, want)
+	}
+	if _, _, err := q.bcheckExpr1(n, 0); err == nil {
+		tt.Errorf("bcheckExpr1: got nil error, want non-nil")
+	} else if got, want := err.Error(), fmt.Sprintf(want, bad.Key(), "bcheckExpr"); got != want {
+		tt.Errorf("bcheckExpr1:\ngot  %s\nwant %s", got, want)
+	}
+
+}
+
+func TestUseCollisions(tt *testing.T) {
+	resolveUse := func(usePath string) ([]byte, error) {
+		if usePath != "foo/zlib.wuffs" {
+			return nil, fmt.Errorf("cannot resolve %q", usePath)
+		}
+		return []byte("packageid \"zlib\"\npub struct decoder(x u32)\n"), nil
+	}
+
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"use \"foo/zlib\"\npri struct bar(d zlib.decoder)\n", ""},
+		{"use \"foo/zlib\" as z\npri struct bar(d z.decoder)\n", ""},
+		{"use \"foo/zlib\" as z\npri struct zlib(d z.decoder)\n", ""},
+		{"use \"foo/zlib\" as z\npri func foo()() {\n\tvar zlib u32\n}\n", ""},
+		{"use \"foo/zlib\"\npri struct zlib(x u32)\n",
+			"`use \"foo/zlib\"` package name \"zlib\" collides with the struct \"zlib\"; " +
+				"rename one or alias the package, as in `use \"foo/zlib\" as other_name` " +
+				"at test.wuffs:2 and test.wuffs:3"},
+		{"use \"foo/zlib\"\npri const zlib u32 = 1\n",
+			"collides with the const \"zlib\""},
+		{"use \"foo/zlib\"\npri func zlib()() {\n}\n",
+			"collides with the function \"zlib\""},
+		{"use \"foo/zlib\"\npri func foo()() {\n\tvar zlib u32\n}\n",
+			"collides with the local variable \"zlib\""},
+		{"use \"foo/zlib\" as z\npri const z u32 = 1\n",
+			"`use \"foo/zlib\"` package name \"z\" collides with the const \"z\""},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		const filename = "test.wuffs"
+		tokens, _, err := t.Tokenize(tm, filename, []byte("packageid \"test\"\n"+tc.src))
+		if err != nil {
+			tt.Errorf("%q: Tokenize: %v", tc.src, err)
+			continue
+		}
+		file, err := parse.Parse(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Errorf("%q: Parse: %v", tc.src, err)
+			continue
+		}
+		_, err = Check(tm, []*a.File{file}, resolveUse, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestNumLiteralSuffixes(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri const x u8 = 42\n", ""},
+		{"pri const x u8 = 42u8\n", ""},
+		{"pri const x i16 = 7i16\n", ""},
+		{"pri const x u16 = 0xFFFFu16\n", ""},
+		{"pri func foo()() {\n\tvar y u32\n\ty = 5u32 + 1\n}\n", ""},
+		{"pri const x u8 = 300u8\n", `numeric literal "300u8" is not within the bounds [0..255] of its type "u8"`},
+		{"pri const x i8 = 128i8\n", `numeric literal "128i8" is not within the bounds [-128..127] of its type "i8"`},
+		{"pri const x u8 = 42q9\n", `numeric literal "42q9" has type suffix "q9", which is not a numeric type`},
+		{"pri const x u8 = 1bool\n", `numeric literal "1bool" has type suffix "bool", which is not a numeric type`},
+		{"pri const x u8 = 0x1Fu\n", `numeric literal "0x1Fu" has type suffix "u", which is not a numeric type`},
+		{"pri const x u16 = 42u8 as u16\n",
+			`conversion of "42u8", a literal with a type suffix, as type "u16"; write "42u16" instead`},
+		{"pri const x u16 = 42u8\n", `invalid const value "42u8", of type "u8", for type "u16"`},
+		{"pri const x[2] u8 = $(1u8, 2u16)\n", `invalid const value "2u16", of type "u16", for type "u8"`},
+		{"pri func foo()() {\n\tvar y u32\n\ty = 5u8\n}\n", `cannot assign "5u8" of type "u8" to "y" of type "u32"`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		_, err := checkSource(tm, tc.src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestComptimeCalls(tt *testing.T) {
+	const square = "pri func square(x u32[..1000])(ret u32) {\n\tout.ret = in.x * in.x\n}\n"
+	testCases := []struct {
+		src     string
+		want    int64
+		wantErr string
+	}{
+		{square + "pri const c u32 = square(x:7)\n", 49, ""},
+		{"pri func sum(n u32)(ret u32) {\n" +
+			"\tvar i u32[..100]\n\tvar s u32\n" +
+			"\twhile i < 100 {\n\t\tif i < in.n {\n\t\t\ts ~+= i\n\t\t}\n\t\ti += 1\n\t}\n" +
+			"\tout.ret = s\n}\n" +
+			"pri const c u32 = sum(n:11)\n", 55, ""},
+		{"pri func pick(x u32)(ret u32) {\n" +
+			"\tif in.x > 10 {\n\t\tout.ret = 1\n" +
+			"\t} else if in.x > 5 {\n\t\tout.ret = 2\n" +
+			"\t} else {\n\t\tout.ret = 3\n\t}\n}\n" +
+			"pri const c u32 = pick(x:7)\n", 2, ""},
+		// The called function can refer to a const declared after it.
+		{"pri const c u32 = add_k(x:1)\n" +
+			"pri func add_k(x u32[..100])(ret u32) {\n\tout.ret = in.x + k\n}\n" +
+			"pri const k u32 = 9\n", 10, ""},
+		{square + "pri const c u32 = square(x:2) + square(x:3)\n", 13, ""},
+
+		{square + "pri const c u32 = square(x:2000)\n",
+			-1, `cannot evaluate "square(x:2000)" at compile time: value 2000 for "x" is not within [0..1000]`},
+		{square + "pri const t[2] u32 = $(3, 4)\npri const c u32 = square(x:t[0])\n",
+			-1, `cannot evaluate "square(x:t[0])" at compile time: argument "t[0]" is not constant`},
+		{"pri func f!()(ret u32) {\n}\npri const c u32 = f!()\n",
+			-1, `cannot evaluate "f!()" at compile time: "f" is not pure`},
+		{"pri func two()(a u32, b u32) {\n}\npri const c u32 = two()\n",
+			-1, `"two" does not have exactly one out-parameter`},
+		{"pri func spin()(ret u32) {\n\twhile true {\n\t}\n}\npri const c u32 = spin()\n",
+			-1, `cannot evaluate "spin()" at compile time: it does not finish within 1048576 steps`},
+		{"pri func f(n u32[..100])(ret u32) {\n" +
+			"\tvar i u32[..100]\n\twhile i < in.n {\n" +
+			"\t\tif i == 5 {\n\t\t\tbreak\n\t\t}\n\t\ti += 1\n\t}\n" +
+			"\tout.ret = i\n}\n" +
+			"pri const c u32 = f(n:10)\n",
+			-1, `the statement at line 6 is not a var, assignment, if or while statement`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkSource(tm, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: %v", tc.src, err)
+			continue
+		}
+		k := c.consts[t.QID{0, tm.ByName("c")}]
+		if got := k.Value().ConstValue(); got == nil || got.Int64() != tc.want {
+			tt.Errorf("%q: got %v, want %d", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestUnreachableFuncs(tt *testing.T) {
+	const src = `
+		pub struct foo()
+		pub func foo.run!()() {
+			this.used!()
+		}
+		pri func foo.used!()() {
+			this.also_used!()
+		}
+		pri func foo.also_used!()() {
+		}
+		pri func foo.dead!()() {
+			this.also_dead!()
+		}
+		pri func foo.also_dead!()() {
+		}
+		// wuffs:nowarn unreachable-func
+		pri func foo.kept!()() {
+		}
+		pri func square(x u32[..100])(ret u32) {
+			out.ret = in.x * in.x
+		}
+		pri const c u32 = square(x:7)
+	`
+	c, err := checkSourceAllWarnings(&t.Map{}, src, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	got := []string(nil)
+	for _, w := range c.Warnings() {
+		got = append(got, fmt.Sprintf("%d %s", w.Line, w.Category))
+	}
+	want := []string{
+		"12 unreachable-func",
+		"15 unreachable-func",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestCallPreconditions(tt *testing.T) {
+	const decls = `
+		pri struct s(
+			n u32,
+		)
+
+		pri func s.bar!(x u32, y u32)(), pre in.x < 10, pre in.y <= this.n {
+		}
+	`
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"this.bar!(x:3, y:0)", ""},
+		{"if in.a < 5 {\n\tthis.bar!(x:in.a, y:0)\n}", ""},
+		{"if this.n >= 7 {\n\tthis.bar!(x:0, y:7)\n}", ""},
+		{"this.bar!(x:12, y:0)",
+			`cannot prove "12 < 10", the precondition "in.x < 10" of s.bar, for the call "this.bar!(x:12, y:0)"; ` +
+				`the caller's facts are: none`},
+		{"this.bar!(x:in.a, y:0)",
+			`cannot prove "in.a < 10", the precondition "in.x < 10" of s.bar, for the call ` +
+				`"this.bar!(x:in.a, y:0)"; the caller's facts are: none; if the caller cannot prove it, ` +
+				`consider adding "pre in.a < 10" to s.foo's own preconditions`},
+		{"if in.a < 20 {\n\tthis.bar!(x:in.a, y:0)\n}",
+			`the caller's facts are: in.a < 20; if the caller cannot prove it, consider adding "pre in.a < 10"`},
+		{"var i u32 = in.a\nthis.bar!(x:0, y:i)",
+			`cannot prove "i <= this.n", the precondition "in.y <= this.n" of s.bar, for the call ` +
+				`"this.bar!(x:0, y:i)"; the caller's facts are: i == in.a`},
+		{"this.bar!(x:out.b, y:0)",
+			`cannot prove "out.b < 10", the precondition "in.x < 10" of s.bar, for the call ` +
+				`"this.bar!(x:out.b, y:0)"; the caller's facts are: none`},
+	}
+
+	for _, tc := range testCases {
+		src := decls + "pri func s.foo(a u32)(b u32) {\n" + tc.body + "\n}\n"
+		_, err := checkSource(&t.Map{}, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		} else if (strings.Contains(tc.body, "var i") || strings.Contains(tc.body, "out.b")) &&
+			strings.Contains(err.Error(), "consider adding") {
+			tt.Errorf("%q: got %v, want no suggestion for a local variable or an out-param", tc.body, err)
+		}
+	}
+}
+
+func TestChainedLvalues(tt *testing.T) {
+	const decls = `
+		pri struct buf(
+			count u32,
+			data[4] u8,
+		)
+
+		pri struct s(
+			buffers[3] buf,
+			n u32,
+		)
+	`
+	testCases := []struct {
+		stmt    string
+		wantErr string
+	}{
+		{"this.buffers[in.i].count = 0", ""},
+		{"this.buffers[in.i].data[3] = 7", ""},
+		{"this.buffers[in.i].count = this.buffers[0].count", ""},
+		{"this.buffers[1].nope = 0",
+			`no field or method named "nope" found in type "buf", the element type of "this.buffers", ` +
+				`for expression "this.buffers[1].nope"`},
+		{"this.buffers[3].count = 0",
+			`index "3" of "this.buffers", of type "[3] buf", is not proven in range: cannot prove "3 < 3"`},
+		{"this.buffers[in.i].data[in.i + 2] = 0",
+			`index "in.i + 2" of "this.buffers[in.i].data", of type "[4] u8", is not proven in range`},
+		{"this.buffers[in.i].data[0] = 300", `constant 300 is not within bounds [0..255]`},
+		{"this.buffers[in.i].count = true", `cannot assign "true" of type "bool"`},
+	}
+
+	for _, tc := range testCases {
+		src := decls + "pri func s.foo(i u32[..2])() {\n" + tc.stmt + "\n}\n"
+		_, err := checkSource(&t.Map{}, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+		}
+	}
+}
+
+func TestNaming(tt *testing.T) {
+	const src = `
+		pri const MAX_SIZE u32 = 16
+		pri const min_size u32 = 1
+		pri struct decoder(
+			good_field u32,
+			BadField u32,
+		)
+		pri func decoder.run(in_param u32)() {
+			var ok_var u32
+			var Bad_var u32
+			// wuffs:nowarn naming
+			var Suppressed u32
+		}
+		pri func decoder.Bad__name()() {
+		}
+	`
+	policy := &NamingPolicy{
+		Consts:  NamingScreamingSnakeCase,
+		Funcs:   NamingSnakeCase,
+		Structs: NamingSnakeCase,
+		Fields:  NamingSnakeCase,
+		Vars:    NamingSnakeCase,
+	}
+	c, err := checkSourceWithOptions(&t.Map{}, src, &Options{Naming: policy})
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	got := []string(nil)
+	for _, w := range c.Warnings() {
+		got = append(got, fmt.Sprintf("%d %v", w.Line, w.Err))
+	}
+	want := []string{
+		`4 check: const "min_size" is not in SCREAMING_SNAKE_CASE, as the naming policy requires`,
+		`5 check: field "BadField" is not in snake_case, as the naming policy requires`,
+		`11 check: var "Bad_var" is not in snake_case, as the naming policy requires`,
+		`15 check: func "Bad__name" is not in snake_case, as the naming policy requires`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+
+	c, err = checkSource(&t.Map{}, src)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	for _, w := range c.Warnings() {
+		if w.Category == WarningNaming {
+			tt.Fatalf("got %v, want no naming warnings without a policy", w)
+		}
+	}
+}
+
+func TestNonBoolConditions(tt *testing.T) {
+	testCases := []struct {
+		stmt    string
+		wantErr string
+	}{
+		{"if in.x != 0 {\n}", ""},
+		{"if in.x {\n}", `if condition "in.x", of type "u32", does not have a boolean type; ` +
+			`a number is not implicitly true when non-zero, so write "in.x != 0" instead`},
+		{"while in.x & 1 {\n}", `for-loop condition "in.x & 1", of type "u32", does not have a boolean type; ` +
+			`a number is not implicitly true when non-zero, so write "(in.x & 1) != 0" instead`},
+		{"if in.b {\n} else if in.x as u64 {\n}", `write "(in.x as u64) != 0" instead`},
+		{"assert 1", `assert condition "1", of type "ℤ", does not have a boolean type; ` +
+			`a number is not implicitly true when non-zero, so write "1 != 0" instead`},
+		{"if in.p {\n}", `if condition "in.p", of type "ptr u8", does not have a boolean type; ` +
+			`a ptr is never null, so it does not need testing`},
+		{"if in.s {\n}", `if condition "in.s", of type "[] u8", does not have a boolean type at`},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x u32, b bool, p ptr u8, s[] u8)() {\n" + tc.stmt + "\n}\n"
+		_, err := checkSource(&t.Map{}, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+		}
+	}
+}
+
+func TestCallSites(tt *testing.T) {
+	const src = `
+pri struct s()
+
+pri func s.bar!(x u32)() {
+}
+
+pri func s.foo(i u32)() {
+	this.bar!(x:in.i)
+}
+
+pri func s.qux()() {
+	this.bar!(x:1)
+
+	this.bar!(x:2)
+	this.bar!(x:3 |
+		this.one())
+}
+
+pri func s.one()(y u32) {
+	return 1
+}
+`
+	tm := &t.Map{}
+	c, err := checkSource(tm, src)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	bar := t.QQID{0, tm.ByName("s"), tm.ByName("bar")}
+	got := []string(nil)
+	for _, s := range c.CallSites(bar) {
+		got = append(got, fmt.Sprintf("%s:%d %s", s.Caller.Str(tm), s.Line, s.Call.Str(tm)))
+	}
+	want := []string{
+		"s.foo:9 this.bar!(x:in.i)",
+		"s.qux:13 this.bar!(x:1)",
+		"s.qux:15 this.bar!(x:2)",
+		"s.qux:16 this.bar!(x:3 | this.one())",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+
+	// A call on a later line of a statement is reported at its own line.
+	one := t.QQID{0, tm.ByName("s"), tm.ByName("one")}
+	if got := c.CallSites(one); len(got) != 1 || got[0].Line != 17 {
+		tt.Fatalf("CallSites(s.one): got %v, want one call site at line 17", got)
+	}
+
+	foo := t.QQID{0, tm.ByName("s"), tm.ByName("foo")}
+	if got := c.CallSites(foo); len(got) != 0 {
+		tt.Fatalf("CallSites(s.foo): got %v, want none", got)
+	}
+}
+
+func TestStructReferences(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri struct a(x a)\n", "cyclical struct definitions: a -> a"},
+		{"pri struct a(x u8, y b)\npri struct b(z [4] c)\npri struct c(w a)\n",
+			"cyclical struct definitions: a -> b -> c -> a"},
+		{"pri struct a(x b)\npri struct b(y [2] [3] b)\n", "cyclical struct definitions: b -> b"},
+		{"pri struct a(x b, y b)\npri struct b(z u32)\n", ""},
+		{"pri struct a(x [2] b)\npri struct b(z c)\npri struct c()\n", ""},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		_, err := checkSource(tm, tc.src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestTypeParams(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri struct ring_buffer[T](data [8] T, n u32)\n", ""},
+		{"pri struct pair[K, V](k K, v V)\n", ""},
+		{"pri struct s()\npri func s.id[T](x T)(y T) {\n\tvar z T = in.x\n\tout.y = z\n}\n", ""},
+		{"pri struct ring_buffer[T](data [8] U, n T)\n", `"U" is not a type`},
+		{"pri struct pair[K, K](k K)\n", `duplicate type parameter "K"`},
+		{"pri struct pair[K, V](k K)\n", `type parameter "V" is not used`},
+		{"pri struct foo[u8](x u8)\n", `type parameter "u8" has the same name as a built-in type`},
+		{"pri struct bar()\npri struct foo[bar](x bar)\n", `type parameter "bar" has the same name as a struct`},
+		{"pri struct foo[T](x T[..3])\n", `type parameter "T[..3]" cannot be refined`},
+		{"pri struct s()\npri func s.f[T](x T)() {\n\tvar y u32 = in.x\n}\n", "cannot assign"},
+		{"pri struct s()\npri func s.f[T]()() {\n}\n", `type parameter "T" is not used`},
+		{"pri struct foo[T: numeric](x T)\n", ""},
+		{"pri struct foo[T: numeric, U: struct](x T, y U)\n", ""},
+		{"pri struct foo[T: interface](x T)\n", `type parameter "T" has unknown constraint "interface"`},
+		{"pri struct foo[T: ptr](x T)\n", `type parameter "T" has unknown constraint "ptr"`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		_, err := checkSource(tm, tc.src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestInstantiate(tt *testing.T) {
+	const ringBuffer = "pri struct ring_buffer[T](data [8] T, n u32)\n"
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{ringBuffer + "pri struct s(b ring_buffer[u8])\n", ""},
+		{ringBuffer + "pri struct s(b ring_buffer[u8], c ring_buffer[u16])\n", ""},
+		{ringBuffer + "pri struct s(b ring_buffer[u8])\npri func s.f!()() {\n\tthis.b.data[0] = 1\n}\n", ""},
+		{ringBuffer + "pri struct s(b ring_buffer[u8])\npri func s.f!()() {\n\tthis.b.data[0] = 300\n}\n",
+			"constant 300 is not within bounds [0..255]"},
+		{ringBuffer + "pri struct s(b ring_buffer[u8, u8])\n",
+			"struct ring_buffer has 1 type parameters but 2 type arguments were given"},
+		{ringBuffer + "pri struct s(b ring_buffer)\n", `generic struct "ring_buffer" needs type arguments`},
+		{"pri struct foo(x u8)\npri struct s(b foo[u8])\n", "struct foo is not generic"},
+		{"pri struct foo[T: numeric](x T)\npri struct s(b foo[u16])\n", ""},
+		{"pri struct foo[T: numeric](x T)\npri struct s(b foo[bool])\n",
+			`type argument "bool" does not satisfy the "numeric" constraint of type parameter "T"`},
+		{"pri struct foo[T: struct](x T)\npri struct bar()\npri struct s(b foo[bar])\n", ""},
+		{"pri struct foo[T: struct](x T)\npri struct bar()\npri struct s(b foo[bar], c foo[u8])\n",
+			`type argument "u8" does not satisfy the "struct" constraint of type parameter "T"`},
+		{ringBuffer + "pri struct s(b ring_buffer[s])\n", "cyclical struct definitions: s -> s"},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		_, err := checkSource(tm, tc.src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+
+	tm := &t.Map{}
+	c, err := checkSource(tm, ringBuffer)
+	if err != nil {
+		tt.Fatalf("checkSource: %v", err)
+	}
+	s := c.structs[t.QID{0, tm.ByName("ring_buffer")}]
+	u8 := a.NewTypeExpr(0, 0, t.IDU8, nil, nil, nil)
+	got0, err := c.Instantiate(s, []*a.TypeExpr{u8})
+	if err != nil {
+		tt.Fatalf("Instantiate: %v", err)
+	}
+	got1, err := c.Instantiate(s, []*a.TypeExpr{a.NewTypeExpr(0, 0, t.IDU8, nil, nil, nil)})
+	if err != nil {
+		tt.Fatalf("Instantiate: %v", err)
+	}
+	if got0 != got1 {
+		tt.Errorf("Instantiate: got different structs for the same type arguments")
+	}
+	if len(got0.TypeParams()) != 0 {
+		tt.Errorf("Instantiate: got %d type parameters, want 0", len(got0.TypeParams()))
+	}
+	if got, want := got0.Fields()[0].Field().XType().Str(tm), "[8] u8"; got != want {
+		tt.Errorf("Instantiate: data field: got %q, want %q", got, want)
+	}
+}
+
+func TestBufferSlicesAcrossSuspension(tt *testing.T) {
+	const prefix = "pri struct foo?(t [4] u8)\npri func foo.bar?(dst writer1)() {\n" +
+		"\tvar s[] u8\n\tvar n u64\n\tin.dst.mark!()\n"
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"\ts = in.dst.since_mark()\n\tn = s.length()\n", ""},
+		{"\ts = in.dst.since_mark()\n\tin.dst.write_u8?(x:1)\n\tn = s.length()\n",
+			`slice "s" may be invalidated by suspension`},
+		{"\ts = in.dst.since_mark()\n\tin.dst.write_u8?(x:1)\n\ts = in.dst.since_mark()\n\tn = s.length()\n", ""},
+		{"\ts = in.dst.since_mark()\n\ts = s[0:]\n\tin.dst.write_u8?(x:1)\n\tn = s.length()\n",
+			`slice "s" may be invalidated by suspension`},
+		{"\ts = in.dst.since_mark()\n\tif n == 0 {\n\t\tin.dst.write_u8?(x:1)\n\t}\n\tn = s.length()\n",
+			`slice "s" may be invalidated by suspension`},
+		{"\ts = in.dst.since_mark()\n\twhile n == 0 {\n\t\tn = s.length()\n\t\tin.dst.write_u8?(x:1)\n\t}\n",
+			`slice "s" may be invalidated by suspension`},
+		{"\twhile n == 0 {\n\t\tin.dst.write_u8?(x:1)\n\t\ts = in.dst.since_mark()\n\t\tn = s.length()\n\t}\n", ""},
+		{"\ts = in.dst.since_mark()\n\tin.dst.write_u8?(x:1)\n\ts = this.t[:]\n\tn = s.length()\n", ""},
+		// x is not derived from the buffer, so this fails the later check
+		// that any slice, not just a buffer-derived one, is re-assigned
+		// after a suspension point.
+		{"\ts = in.dst.since_mark()\n\tvar x[] u8 = this.t[(s.length() & 3):]\n\tin.dst.write_u8?(x:1)\n\tn = x.length()\n",
+			`local variable "x", of type "[] u8", is used after a suspension point`},
+		{"\ts = in.dst.since_mark()\n\tvar x[] u8 = s.prefix(up_to:2)\n\tin.dst.write_u8?(x:1)\n\tn = x.length()\n",
+			`slice "x" may be invalidated by suspension`},
+	}
+
+	for _, tc := range testCases {
+		src := prefix + tc.body + "}\n"
+		tm := &t.Map{}
+		_, err := checkSource(tm, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLocalsAcrossSuspension(tt *testing.T) {
+	const prefix = "pri struct foo?(t [4] u8)\npri func foo.bar?(dst writer1)() {\n" +
+		"\tvar s[] u8\n\tvar n u64\n\tvar z status\n"
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"\ts = this.t[:]\n\tn = s.length()\n", ""},
+		{"\ts = this.t[:]\n\tin.dst.write_u8?(x:1)\n\tn = s.length()\n",
+			`local variable "s", of type "[] u8", is used after a suspension point`},
+		{"\ts = this.t[:]\n\tyield z\n\tn = s.length()\n",
+			`local variable "s", of type "[] u8", is used after a suspension point`},
+		{"\ts = this.t[:]\n\tin.dst.write_u8?(x:1)\n\ts = this.t[:]\n\tn = s.length()\n", ""},
+		{"\ts = this.t[:]\n\tvar y status = try in.dst.write_u8?(x:1)\n\tn = s.length()\n", ""},
+		{"\tn = 1\n\tin.dst.write_u8?(x:1)\n\tn += 1\n", ""},
+		{"\ts = this.t[:]\n\twhile n == 0 {\n\t\tn = s.length()\n\t\tyield z\n\t}\n",
+			`local variable "s", of type "[] u8", is used after a suspension point`},
+	}
+
+	for _, tc := range testCases {
+		src := prefix + tc.body + "}\n"
+		tm := &t.Map{}
+		_, err := checkSource(tm, src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.body, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestConstDependencies(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri const a u8 = a + 1\n", "cyclical const definitions: a -> a"},
+		{"pri const a u8 = b + 1\npri const b u8 = c\npri const c u8 = a\n",
+			"cyclical const definitions: a -> b -> c -> a"},
+		{"pri const b u32 = a + 1\npri const a u32 = 2\n", ""},
+		{"pri const t[n] u8 = $(1, 2, 3, 4)\npri const n u32 = 4\n", ""},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkSource(tm, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			continue
+		}
+		if k := c.consts[t.QID{0, tm.ByName("b")}]; k != nil {
+			if got := k.Value().ConstValue(); got == nil || got.Int64() != 3 {
+				tt.Errorf("%q: const b: got %v, want 3", tc.src, got)
+			}
+		}
+	}
+}
+
+func TestDiagnosticRender(tt *testing.T) {
+	const src = "packageid \"test\"\npri func foo()() {\n\tvar x u8 = 300\n}\n"
+	tm := &t.Map{}
+	_, err := checkSource(tm, src[len("packageid \"test\"\n"):])
+	e, ok := err.(*Error)
+	if !ok {
+		tt.Fatalf("got %v, want an *Error", err)
+	}
+	d := e.Diagnostic()
+	got := d.Render([]byte(src))
+	want := d.Message + " at test.wuffs:3\n" +
+		"3 | \tvar x u8 = 300\n" +
+		"  | \t^^^^^^^^^^^^^^\n"
+	if got != want {
+		tt.Errorf("single line:\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	d.EndLine = 4
+	if got, want := d.Render([]byte(src)), want+"  | ... (continues to line 4)\n"; got != want {
+		tt.Errorf("multi-line:\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	d.Line = 99
+	if got, want := d.Render([]byte(src)), d.Message+" at test.wuffs:99\n"; got != want {
+		tt.Errorf("out of range:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestShiftLostBits(tt *testing.T) {
+	testCases := []struct {
+		stmt      string
+		wantConst string
+		wantWarn  bool
+		wantErr   string
+	}{
+		{"var y u8 = k << 4", "240", false, ""},
+		{"var y u8 = f << 4", "240", true, ""},
+		{"var y u32 = (f as u32) << 4", "", false, ""},
+		{"var y u8 = in.x << 6", "", false, ""},
+		{"var y u8 = (in.x << 7) & 0x80", "", false, `shift "in.x << 7" might lose bits`},
+		{"var y u16 = (in.x as u16) << 7", "", false, ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri const k u8 = 0x0F\npri const f u8 = 0xFF\n" +
+			"pri func foo(x u8[..3])() {\n\t" + tc.stmt + "\n}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: %v", tc.stmt, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			got := ""
+			if cv := f.Body()[0].Var().Value().ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.stmt, got, tc.wantConst)
+			}
+		}
+		ws := c.Warnings()
+		if gotWarn := len(ws) == 1 && ws[0].Category == WarningShiftLostBits; gotWarn != tc.wantWarn ||
+			(!tc.wantWarn && len(ws) != 0) {
+			tt.Errorf("%q: got warnings %v, want a %q warning: %t", tc.stmt, ws, WarningShiftLostBits, tc.wantWarn)
+		}
+	}
+}
+
+func TestScope(tt *testing.T) {
+	tm := &t.Map{}
+	x, err := tm.Insert("x")
+	if err != nil {
+		tt.Fatalf("Insert: %v", err)
+	}
+	lookup := func(s *Scope) string {
+		typ, ok := s.Lookup(x)
+		if !ok {
+			return "<none>"
+		}
+		return typ.Str(tm)
+	}
+
+	s := NewScope()
+	if got, want := lookup(s), "<none>"; got != want {
+		tt.Fatalf("before Declare: got %q, want %q", got, want)
+	}
+	if !s.Declare(x, typeExprU32) {
+		tt.Fatalf("Declare: got false, want true")
+	}
+	if s.Declare(x, typeExprU8) {
+		tt.Fatalf("duplicate Declare: got true, want false")
+	}
+
+	// An inner declaration shadows the outer one, until it is popped.
+	s.Push()
+	if !s.Declare(x, typeExprBool) {
+		tt.Fatalf("shadowing Declare: got false, want true")
+	}
+	if got, want := lookup(s), "bool"; got != want {
+		tt.Fatalf("after shadowing: got %q, want %q", got, want)
+	}
+	if got, want := s.Vars()[x].Str(tm), "bool"; got != want {
+		tt.Fatalf("Vars after shadowing: got %q, want %q", got, want)
+	}
+	s.Pop()
+	if got, want := lookup(s), "u32"; got != want {
+		tt.Fatalf("after popping the shadow: got %q, want %q", got, want)
+	}
+	if got := s.Depth(); got != 1 {
+		tt.Fatalf("Depth: got %d, want 1", got)
+	}
+
+	// The checker pushes and pops a frame for each nested body.
+	const src = "pri func foo()() {\n\tvar i u32\n\twhile i < 3 {\n" +
+		"\t\tif i == 0 {\n\t\t\ti = 1\n\t\t} else {\n\t\t\ti = 3\n\t\t}\n\t}\n}\n"
+	c, err := checkSource(tm, src)
+	if err != nil {
+		tt.Fatalf("checkSource: %v", err)
+	}
+	if got := c.scopes[t.QQID{0, 0, tm.ByName("foo")}].Depth(); got != 1 {
+		tt.Fatalf("Depth after checking: got %d, want 1", got)
+	}
+}
+
+func TestSizeof(tt *testing.T) {
+	const structs = "" +
+		"pri struct header(magic [4] u8, version u32, length u64)\n" +
+		"pri struct padded(a u8, b u32, c u16)\n" +
+		"pri struct outer(a u8, b padded, c [2] u16)\n" +
+		"pri struct sized(x [N] u32)\n" +
+		"pri const N u32 = 3\n" +
+		"pri struct empty()\n" +
+		"pri struct susp?(x u32)\n" +
+		"pri struct ring[T: numeric](x T)\n"
+
+	testCases := []struct {
+		decl      string
+		wantValue string
+		wantErr   string
+	}{
+		{"pri const c u32 = sizeof(u16)", "2", ""},
+		{"pri const c u32 = sizeof(i64)", "8", ""},
+		{"pri const c u32 = sizeof([3] u16)", "6", ""},
+		{"pri const c u32 = sizeof(header)", "16", ""},
+		{"pri const c u32 = sizeof(padded)", "12", ""},
+		{"pri const c u32 = sizeof(outer)", "20", ""},
+		{"pri const c u32 = sizeof([2] padded)", "24", ""},
+		{"pri const c u32 = sizeof(sized)", "12", ""},
+		{"pri const c u32 = sizeof(empty)", "0", ""},
+		{"pri const c u32 = sizeof(header) + 1", "17", ""},
+
+		// A refined type asserts the size at compile time.
+		{"pri const c u32[16..16] = sizeof(header)", "16", ""},
+		{"pri const c u32[16..16] = sizeof(padded)", "",
+			`invalid const value "sizeof(padded)", which is 12, not within [16..16]`},
+
+		{"pri const c u32 = sizeof([] u8)", "", `size cannot be computed for "sizeof([] u8)": "[] u8" is a slice`},
+		{"pri const c u32 = sizeof(reader1)", "", `"reader1"'s size depends on the platform`},
+		{"pri const c u32 = sizeof(usize)", "", `"usize"'s size depends on the platform`},
+		{"pri const c u32 = sizeof(susp)", "", `"susp" is a suspendible struct`},
+		{"pri const c u32 = sizeof(ring[u8])", "", `"ring[u8]" is a generic type`},
+		{"pri const c u32 = sizeof(nosuch)", "", `"nosuch" is not a type`},
+		{"pri struct self(x [sizeof(self)] u8)", "", `"self"'s size depends on itself`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkSource(tm, structs+tc.decl+"\n")
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.decl, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.decl, err)
+			continue
+		}
+		got := ""
+		if cv := c.consts[t.QID{0, tm.ByName("c")}].Value().ConstValue(); cv != nil {
+			got = cv.String()
+		}
+		if got != tc.wantValue {
+			tt.Errorf("%q: got %q, want %q", tc.decl, got, tc.wantValue)
+		}
+	}
+
+	// sizeof is also a constant within a function body.
+	tm := &t.Map{}
+	c, err := checkSource(tm, structs+"pri func foo()() {\n\tvar x u32 = sizeof(header)\n}\n")
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	for _, f := range c.funcs {
+		if cv := f.Body()[0].Var().Value().ConstValue(); cv == nil || cv.String() != "16" {
+			tt.Errorf("var x: got %v, want 16", cv)
+		}
+	}
+}
+
+func TestStrLiteralLength(tt *testing.T) {
+	testCases := []struct {
+		stmt      string
+		wantConst string
+		wantErr   string
+	}{
+		{"var h [4] u8 = \"WUFF\"", "", ""},
+		{"var n u64 = \"WUFF\".length()", "4", ""},
+		{"var n u64 = \"\".length()", "0", ""},
+		{"var n u64[..4] = \"WUFF\".length()", "4", ""},
+		{"var h [3] u8 = \"WUFF\"", "", `cannot initialize "h", of type "[3] u8", from "\"WUFF\"" of length 4`},
+		{"var h [4] u16 = \"WUFF\"", "", `string literal "WUFF" can only initialize a "[N] u8" array`},
+		{"var h u32 = \"WUFF\"", "", `string literal "WUFF" can only initialize a "[N] u8" array`},
+		{"var x [] u8 = \"WUFF\"", "", `string literal "WUFF" can only initialize a "[N] u8" array`},
+		{"var x u8 = \"WUFF\"[0]", "", `string literal "WUFF" can only initialize a "[N] u8" array`},
+		{"var x u64 = \"WUFF\"[1:].length()", "", `string literal "WUFF" can only initialize`},
+		{"\"WUFF\"[0] = 3", "", `string literal "WUFF" can only initialize a "[N] u8" array`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		c, err := checkFuncBody(tm, tc.stmt)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			got := ""
+			if cv := f.Body()[0].Var().Value().ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.stmt, got, tc.wantConst)
+			}
+		}
+	}
+}
+
+func TestInParamAssign(tt *testing.T) {
+	testCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{"pri func foo(x u32)(y u32) {\n\tout.y = in.x\n}\n", ""},
+		{"pri func foo(var x u32)() {\n\tin.x = 3\n}\n", ""},
+		{"pri func foo(var x u32[..9])() {\n\tin.x >>= 1\n}\n", ""},
+		{"pri func foo(x u32)() {\n\tin.x = 3\n}\n", `cannot assign to in-parameter "in.x"`},
+		{"pri func foo(x u32[..9])() {\n\tin.x += 1\n}\n", `cannot assign to in-parameter "in.x"`},
+		{"pri func foo(var x u32, y u32)() {\n\tin.y = in.x\n}\n", `cannot assign to in-parameter "in.y"`},
+		{"pri func foo(var x [4] u8)() {\n\tin.x[0] = 3\n}\n", ""},
+		{"pri func foo(x [4] u8)() {\n\tin.x[0] = 3\n}\n", `cannot assign to "in.x[0]", part of in-parameter "in.x"`},
+		{"pri struct bar(f u32)\npri func foo(x [4] bar)() {\n\tin.x[1].f = 3\n}\n",
+			`cannot assign to "in.x[1].f", part of in-parameter "in.x"`},
+		{"pri struct bar(f u32)\npri func foo(x bar)() {\n\tin.x.f = 3\n}\n",
+			`cannot assign to "in.x.f", part of in-parameter "in.x"`},
+		{"pri struct bar(a [4] u8)\npri func bar.foo!(x u32[..3])() {\n\tthis.a[in.x] = 3\n}\n", ""},
+		{"pri func foo()(var y u32) {\n}\n", `field "y" cannot be marked "var"`},
+		{"pri struct bar(var x u32)\n", `field "x" cannot be marked "var"`},
+	}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		_, err := checkSource(tm, tc.src)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("%q: got %v, want nil error", tc.src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("%q: got %v, want error containing %q", tc.src, err, tc.wantErr)
+		}
+	}
+}
+
+func TestNestedAssign(tt *testing.T) {
+	const src = "pri func foo()() {\n\tvar a u32\n\tvar b u32\n\ta = 0\n}\n"
+	testCases := []struct {
+		rhs     func(inner *a.Assign, tm *t.Map) *a.Expr
+		wantErr string
+	}{{
+		// "a = b = 0".
+		func(inner *a.Assign, tm *t.Map) *a.Expr { return (*a.Expr)(inner.Node()) },
+		`assignment to "a" has another assignment, to "b", as its value`,
+	}, {
+		// "a = (b = 0) + 1".
+		func(inner *a.Assign, tm *t.Map) *a.Expr {
+			one, _ := tm.Insert("1")
+			return a.NewExpr(0, t.IDXBinaryPlus, 0, 0, inner.Node(), nil,
+				a.NewExpr(0, 0, 0, one, nil, nil, nil, nil).Node(), nil)
+		},
+		`assignment to "b" is used as an expression`,
+	}}
+
+	for _, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, "test.wuffs", []byte("packageid \"test\"\n"+src))
+		if err != nil {
+			tt.Fatalf("Tokenize: %v", err)
+		}
+		file, err := parse.Parse(tm, "test.wuffs", tokens, nil)
+		if err != nil {
+			tt.Fatalf("Parse: %v", err)
+		}
+		b, err := tm.Insert("b")
+		if err != nil {
+			tt.Fatalf("Insert: %v", err)
+		}
+		for _, d := range file.TopLevelDecls() {
+			if d.Kind() != a.KFunc {
+				continue
+			}
+			body := d.Func().Body()
+			outer := body[2].Assign()
+			inner := a.NewAssign(t.IDEq, a.NewExpr(0, 0, 0, b, nil, nil, nil, nil), outer.RHS())
+			body[2] = a.NewAssign(t.IDEq, outer.LHS(), tc.rhs(inner, tm)).Node()
+			body[2].Raw().SetFilenameLine(outer.Node().Raw().FilenameLine())
+		}
+
+		_, err = Check(tm, []*a.File{file}, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("got %v, want error containing %q", err, tc.wantErr)
+		}
+	}
+}
+
+func TestBuiltInMinMax(tt *testing.T) {
+	testCases := []struct {
+		expr      string
+		wantType  string
+		wantConst string
+		wantErr   string
+	}{
+		{"min(a:3, b:10)", "ℤ", "3", ""},
+		{"max(a:3, b:10)", "ℤ", "10", ""},
+		{"min(a:in.p, b:0)", "u32", "0", ""},
+		{"min(a:in.p, b:in.q)", "u32[2..10]", "", ""},
+		{"max(a:in.p, b:in.q)", "u32[5..20]", "", ""},
+		{"min(a:in.p, b:7)", "u32[2..7]", "", ""},
+		{"max(a:in.p, b:7)", "u32[7..10]", "", ""},
+		{"max(a:in.q, b:in.r)", "u32[5..4294967295]", "", ""},
+		{"min(a:in.r, b:in.r)", "u32", "", ""},
+		{"min(a:in.p, b:in.s)", "", "", "different types"},
+		{"min(a:in.s, b:300)", "", "", "not within the bounds"},
+		{"min(a:in.p, b:true)", "", "", "does not have a numeric type"},
+		{"min(a:in.p)", "", "", "has 2 arguments but 1 were given"},
+		{"min(b:in.p, a:in.q)", "", "", "argument name"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(p u32[2..10] = 2, q u32[5..20] = 5, r u32, s u8)() {\n" +
+			"\tvar x u32 = " + tc.expr + "\n}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.expr, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.expr, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			v := f.Body()[0].Var().Value()
+			if got := v.MType().Str(tm); got != tc.wantType {
+				tt.Errorf("%q: type: got %q, want %q", tc.expr, got, tc.wantType)
+			}
+			got := ""
+			if cv := v.ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.expr, got, tc.wantConst)
+			}
+		}
+	}
+
+	if _, err := checkSource(&t.Map{}, "pri func min()() {\n}\n"); err == nil {
+		tt.Errorf("func min: got nil error, want non-nil")
+	}
+}
+
+func TestBuiltInAbsSign(tt *testing.T) {
+	testCases := []struct {
+		stmt      string
+		wantType  string
+		wantConst string
+		wantErr   string
+	}{
+		{"var x u8 = abs(x:-7)", "ℤ", "7", ""},
+		{"var x i8 = sign(x:-7)", "ℤ", "-1", ""},
+		{"var x u8 = abs(x:in.p)", "u8[0..128]", "", ""},
+		{"var x u8 = abs(x:in.q)", "u8[0..9]", "", ""},
+		{"var x u8 = abs(x:in.r)", "u8[2..5]", "", ""},
+		{"var x u64 = abs(x:in.s)", "u64[0..9223372036854775808]", "", ""},
+		{"var x i8 = sign(x:in.p)", "i8[-1..1]", "", ""},
+		{"var x i8 = sign(x:in.q)", "i8[-1..1]", "", ""},
+		{"var x i8 = sign(x:in.r)", "i8", "-1", ""},
+		{"var x u32 = abs(x:in.u)", "u32", "", ""},
+
+		// abs(-128) does not fit in an i8.
+		{"var x i8 = abs(x:in.p)", "", "", "cannot assign"},
+		{"var x i8 = sign(x:in.u)", "", "", "does not have a signed type"},
+		{"var x u8 = abs(x:true)", "", "", "does not have a numeric type"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(p i8, q i8[-9..3] = 0, r i8[-5..-2] = -2, s i64, u u32)() {\n" +
+			"\t" + tc.stmt + "\n}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			v := f.Body()[0].Var().Value()
+			if got := v.MType().Str(tm); got != tc.wantType {
+				tt.Errorf("%q: type: got %q, want %q", tc.stmt, got, tc.wantType)
+			}
+			got := ""
+			if cv := v.ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.stmt, got, tc.wantConst)
+			}
+		}
+		if tc.stmt == "var x u32 = abs(x:in.u)" {
+			if ws := c.Warnings(); len(ws) != 1 || ws[0].Category != WarningRedundantAbs {
+				tt.Errorf("%q: got warnings %v, want one %q", tc.stmt, ws, WarningRedundantAbs)
+			}
+		}
+	}
+}
+
+func TestConstantComparisons(tt *testing.T) {
+	testCases := []struct {
+		cond      string
+		wantConst string
+	}{
+		// Disjoint ranges.
+		{"in.x > 100", "0"},
+		{"in.x < in.y", "1"},
+		{"in.x <= in.y", "1"},
+		{"in.x >= in.y", "0"},
+		{"in.y > in.x", "1"},
+		{"in.x == in.y", "0"},
+		{"in.x != in.y", "1"},
+		{"in.x >= 0", "1"},
+		{"in.x <= 10", "1"},
+		{"in.x < 0", "0"},
+
+		// Overlapping ranges.
+		{"in.x > 5", ""},
+		{"in.x < in.z", ""},
+		{"in.x <= in.z", ""},
+		{"in.x >= in.z", ""},
+		{"in.y > in.z", ""},
+		{"in.x == in.z", ""},
+		{"in.x != in.z", ""},
+		{"in.x <= 9", ""},
+
+		// An unrefined operand's range is just its type's.
+		{"in.w >= 0", ""},
+		{"in.w <= 255", ""},
+		{"in.w < 0", ""},
+		{"in.w != in.w", ""},
+	}
+
+	for _, tc := range testCases {
+		src := "pri func foo(x u8[0..10], y u8[20..30] = 20, z u8[5..25] = 5, w u8 = 0)() {\n" +
+			"\tvar b bool = " + tc.cond + "\n}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if err != nil {
+			tt.Errorf("%q: %v", tc.cond, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			got := ""
+			if cv := f.Body()[0].Var().Value().ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.cond, got, tc.wantConst)
+			}
+		}
+		ws := c.Warnings()
+		if tc.wantConst == "" {
+			if len(ws) != 0 {
+				tt.Errorf("%q: got warnings %v, want none", tc.cond, ws)
+			}
+		} else if len(ws) != 1 || ws[0].Category != WarningConstantComparison {
+			tt.Errorf("%q: got warnings %v, want one %q", tc.cond, ws, WarningConstantComparison)
+		}
+	}
+}
+
 func TestBitMask(tt *testing.T) {
 	testCases := [][2]uint64{
 		{0, 0},
@@ -285,6 +2176,61 @@ func TestBitMask(tt *testing.T) {
 	}
 }
 
+func TestBuiltInClzPopcount(tt *testing.T) {
+	testCases := []struct {
+		stmt      string
+		wantType  string
+		wantConst string
+		wantErr   string
+	}{
+		{"var x u8 = popcount(x:k)", "u8", "4", ""},
+		{"var x u8 = clz(x:k)", "u8", "24", ""},
+		{"var x u8 = clz(x:z)", "u8", "32", ""},
+		{"var x u8 = popcount(x:z)", "u8", "0", ""},
+		{"var x u8 = popcount(x:0xF0F0)", "ℤ", "8", ""},
+		{"var x u8 = popcount(x:in.u)", "u8[0..32]", "", ""},
+		{"var x u8 = clz(x:in.u)", "u8[0..32]", "", ""},
+		{"var x u8 = clz(x:in.b)", "u8[8..15]", "", ""},
+		{"var x u8 = popcount(x:in.b)", "u8[1..8]", "", ""},
+
+		{"var x u8 = clz(x:0xFF)", "", "", "has an ideal number type"},
+		{"var x u8 = popcount(x:-1)", "", "", "is negative"},
+		{"var x u8 = popcount(x:in.i)", "", "", "does not have an unsigned integer type"},
+		{"var x u8 = clz(x:true)", "", "", "does not have a numeric type"},
+	}
+
+	for _, tc := range testCases {
+		src := "pri const k u32 = 0xF0\npri const z u32 = 0\n" +
+			"pri func foo(u u32, b u16[1..255] = 1, i i32)() {\n" +
+			"\t" + tc.stmt + "\n}\n"
+		tm := &t.Map{}
+		c, err := checkSource(tm, src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("%q: got %v, want error containing %q", tc.stmt, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("%q: got %v, want nil error", tc.stmt, err)
+			continue
+		}
+		for _, f := range c.funcs {
+			v := f.Body()[0].Var().Value()
+			if got := v.MType().Str(tm); got != tc.wantType {
+				tt.Errorf("%q: type: got %q, want %q", tc.stmt, got, tc.wantType)
+			}
+			got := ""
+			if cv := v.ConstValue(); cv != nil {
+				got = cv.String()
+			}
+			if got != tc.wantConst {
+				tt.Errorf("%q: const value: got %q, want %q", tc.stmt, got, tc.wantConst)
+			}
+		}
+	}
+}
+
 func TestBuiltInTypeMap(tt *testing.T) {
 	if got, want := len(builtInTypeMap), len(builtin.Types); got != want {
 		tt.Fatalf("lengths: got %d, want %d", got, want)
@@ -0,0 +1,418 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// comptimeMaxSteps bounds how many statements, including loop iterations, a
+// compile time call can run, so that a loop that does not finish is an error
+// instead of a hang.
+const comptimeMaxSteps = 1 << 20
+
+// recordFreeFunc records a function that has no receiver, such as "pri func
+// make_table()(ret u32)". This runs before consts are checked, so that a
+// const's value can call such a function at compile time.
+func (c *Checker) recordFreeFunc(node *a.Node) error {
+	n := node.Func()
+	if n.Receiver() != (t.QID{}) {
+		return nil
+	}
+	if c.freeFuncs == nil {
+		c.freeFuncs = map[t.ID]*a.Func{}
+	}
+	// A duplicate is reported later, by checkFuncSignature.
+	if _, ok := c.freeFuncs[n.FuncName()]; !ok {
+		c.freeFuncs[n.FuncName()] = n
+	}
+	return nil
+}
+
+// comptimeFunc returns the function that the call n, in a const's value, can
+// be evaluated with at compile time, or nil if n is not such a call.
+func (q *checker) comptimeFunc(n *a.Expr) *a.Func {
+	if q.astFunc != nil {
+		return nil
+	}
+	lhs := n.LHS().Expr()
+	if lhs.Operator() != 0 || !lhs.Ident().IsIdent() {
+		return nil
+	}
+	return q.c.freeFuncs[lhs.Ident()]
+}
+
+// tcheckComptimeCall evaluates the call n, to the function f, at compile time,
+// setting n's constant value.
+//
+// Only a subset of Wuffs can be evaluated: f must be pure, take constant
+// arguments, have a single numeric or boolean out-parameter, and its body can
+// contain only var, assignment, if and while statements. Numeric and boolean
+// locals can be assigned to, as can in- and out-parameters.
+//
+// TODO: fall back to a run-time call, outside of a const, once calls to
+// functions without a receiver are otherwise supported.
+func (q *checker) tcheckComptimeCall(n *a.Expr, f *a.Func, depth uint32) error {
+	e := &comptime{
+		q:      q,
+		call:   n,
+		in:     map[t.ID]*comptimeVar{},
+		out:    map[t.ID]*comptimeVar{},
+		locals: map[t.ID]*comptimeVar{},
+	}
+	if f.Effect() != 0 || n.Effect() != 0 {
+		return e.errorf("%q is not pure", f.FuncName().Str(q.tm))
+	}
+
+	inFields := f.In().Fields()
+	args, err := q.fillDefaultArgs(n, inFields)
+	if err != nil {
+		return err
+	}
+	n.SetArgs(args)
+	for i, o := range args {
+		arg, field := o.Arg(), inFields[i].Field()
+		if arg.Name() != field.Name() {
+			return fmt.Errorf("check: argument name: got %q, want %q",
+				arg.Name().Str(q.tm), field.Name().Str(q.tm))
+		}
+		if err := q.tcheckExpr(arg.Value(), depth); err != nil {
+			return err
+		}
+		cv := arg.Value().ConstValue()
+		if cv == nil {
+			return e.errorf("argument %q is not constant", arg.Value().Str(q.tm))
+		}
+		if err := e.declare(e.in, field.Name(), field.XType(), cv); err != nil {
+			return err
+		}
+		arg.Node().SetTypeChecked()
+	}
+
+	outFields := f.Out().Fields()
+	if len(outFields) != 1 {
+		return e.errorf("%q does not have exactly one out-parameter", f.FuncName().Str(q.tm))
+	}
+	out := outFields[0].Field()
+	if err := e.declare(e.out, out.Name(), out.XType(), zero); err != nil {
+		return err
+	}
+
+	if _, err := e.block(f.Body()); err != nil {
+		return err
+	}
+	n.SetConstValue(e.out[out.Name()].value)
+	n.SetMType(out.XType())
+	n.LHS().SetTypeChecked()
+	return nil
+}
+
+type comptimeVar struct {
+	value  *big.Int
+	bounds [2]*big.Int
+}
+
+// comptime is the state of a compile time call: the values of the called
+// function's in-parameters, out-parameters and local variables.
+type comptime struct {
+	q      *checker
+	call   *a.Expr
+	in     map[t.ID]*comptimeVar
+	out    map[t.ID]*comptimeVar
+	locals map[t.ID]*comptimeVar
+	steps  int
+}
+
+func (e *comptime) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("check: cannot evaluate %q at compile time: "+format,
+		append([]interface{}{e.call.Str(e.q.tm)}, args...)...)
+}
+
+func (e *comptime) declare(m map[t.ID]*comptimeVar, name t.ID, typ *a.TypeExpr, value *big.Int) error {
+	b, err := e.typeBounds(typ)
+	if err != nil {
+		return err
+	}
+	v := &comptimeVar{bounds: b}
+	m[name] = v
+	return e.set(name, v, value)
+}
+
+func (e *comptime) set(name t.ID, v *comptimeVar, value *big.Int) error {
+	if value.Cmp(v.bounds[0]) < 0 || value.Cmp(v.bounds[1]) > 0 {
+		return e.errorf("value %v for %q is not within [%v..%v]",
+			value, name.Str(e.q.tm), v.bounds[0], v.bounds[1])
+	}
+	v.value = value
+	return nil
+}
+
+// typeBounds returns the bounds of typ, which must be a numeric or boolean
+// type, possibly refined by constant bounds.
+func (e *comptime) typeBounds(typ *a.TypeExpr) ([2]*big.Int, error) {
+	b := [2]*big.Int{}
+	if typ.Decorator() == 0 && typ.QID()[0] == 0 {
+		b = numTypeBounds[typ.QID()[1].Key()]
+	}
+	if b[0] == nil || (b[0].Sign() == 0 && b[1].Sign() == 0) {
+		return b, e.errorf("type %q is not a numeric or boolean type", typ.Str(e.q.tm))
+	}
+	for i, x := range typ.Bounds() {
+		if x == nil {
+			continue
+		}
+		cv, err := e.expr(x)
+		if err != nil {
+			return b, err
+		}
+		b[i] = cv
+	}
+	return b, nil
+}
+
+func (e *comptime) block(block []*a.Node) (returned bool, err error) {
+	for _, o := range block {
+		if e.steps++; e.steps > comptimeMaxSteps {
+			return false, e.errorf("it does not finish within %d steps", comptimeMaxSteps)
+		}
+		switch o.Kind() {
+		case a.KAssert:
+			// No-op. Checking the function's body proves the assertion for
+			// every valid input.
+
+		case a.KAssign:
+			err = e.assign(o.Assign())
+
+		case a.KIf:
+			for x := o.If(); x != nil; x = x.ElseIf() {
+				cond := (*big.Int)(nil)
+				if cond, err = e.expr(x.Condition()); err != nil {
+					return false, err
+				}
+				if cond.Sign() != 0 {
+					returned, err = e.block(x.BodyIfTrue())
+					break
+				}
+				if x.ElseIf() == nil {
+					returned, err = e.block(x.BodyIfFalse())
+				}
+			}
+
+		case a.KRet:
+			if o.Ret().Value() != nil {
+				return false, e.errorf("%q has a return value", o.Ret().Value().Str(e.q.tm))
+			}
+			return true, nil
+
+		case a.KVar:
+			x := o.Var()
+			value := zero
+			if x.Value() != nil {
+				if value, err = e.expr(x.Value()); err != nil {
+					return false, err
+				}
+			}
+			err = e.declare(e.locals, x.Name(), x.XType(), value)
+
+		case a.KWhile:
+			x := o.While()
+			for {
+				if e.steps++; e.steps > comptimeMaxSteps {
+					return false, e.errorf("it does not finish within %d steps", comptimeMaxSteps)
+				}
+				cond, err := e.expr(x.Condition())
+				if err != nil {
+					return false, err
+				}
+				if cond.Sign() == 0 {
+					break
+				}
+				if returned, err = e.block(x.Body()); err != nil || returned {
+					return returned, err
+				}
+			}
+
+		default:
+			_, line := o.Raw().FilenameLine()
+			return false, e.errorf("the statement at line %d is not a var, assignment, if or while statement", line)
+		}
+		if err != nil || returned {
+			return returned, err
+		}
+	}
+	return false, nil
+}
+
+func (e *comptime) assign(n *a.Assign) error {
+	lhs := n.LHS()
+	name, v := e.lookup(lhs)
+	if v == nil {
+		return e.errorf("cannot assign to %q", lhs.Str(e.q.tm))
+	}
+	value, err := e.expr(n.RHS())
+	if err != nil {
+		return err
+	}
+	if op := n.Operator(); op.Key() != t.KeyEq {
+		bin := a.NewExpr(0, op.BinaryForm(), 0, 0, lhs.Node(), nil, n.RHS().Node(), nil)
+		if op.Key() == t.KeyTildePlusEq {
+			// Modular addition wraps around the width of an unsigned type.
+			if v.bounds[0].Sign() != 0 {
+				return e.errorf("%q is not unsigned", lhs.Str(e.q.tm))
+			}
+			m := big.NewInt(1)
+			m.Lsh(m, uint(v.bounds[1].BitLen()))
+			value = big.NewInt(0).Add(v.value, value)
+			value.Mod(value, m)
+		} else if value, err = evalConstValueBinaryOp(e.q.tm, bin, v.value, value); err != nil {
+			return err
+		}
+	}
+	return e.set(name, v, value)
+}
+
+// lookup returns the variable that n, such as "x", "in.x" or "out.x", refers
+// to, or nil if there is no such variable.
+func (e *comptime) lookup(n *a.Expr) (t.ID, *comptimeVar) {
+	switch n.Operator().Key() {
+	case 0:
+		return n.Ident(), e.locals[n.Ident()]
+	case t.KeyDot:
+		if lhs := n.LHS().Expr(); lhs.Operator() == 0 {
+			switch lhs.Ident().Key() {
+			case t.KeyIn:
+				return n.Ident(), e.in[n.Ident()]
+			case t.KeyOut:
+				return n.Ident(), e.out[n.Ident()]
+			}
+		}
+	}
+	return 0, nil
+}
+
+func (e *comptime) expr(n *a.Expr) (*big.Int, error) {
+	if cv := n.ConstValue(); cv != nil {
+		return cv, nil
+	}
+	if _, v := e.lookup(n); v != nil {
+		return v.value, nil
+	}
+
+	op := n.Operator()
+	switch op.Flags() & (t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp) {
+	case 0:
+		if op != 0 {
+			break
+		}
+		id := n.Ident()
+		switch {
+		case id.IsNumLiteral() && !id.IsFloatLiteral():
+			s := id.Str(e.q.tm)
+			digits, suffix := splitNumLiteral(s)
+			z, ok := big.NewInt(0).SetString(digits, 0)
+			if !ok {
+				return nil, fmt.Errorf("check: invalid numeric literal %q", s)
+			}
+			if _, err := e.q.numLiteralType(s, suffix, z); err != nil {
+				return nil, err
+			}
+			return z, nil
+		case id.Key() == t.KeyFalse:
+			return zero, nil
+		case id.Key() == t.KeyTrue:
+			return one, nil
+		}
+		if c := e.q.c.consts[t.QID{0, id}]; c != nil && c.XType().Decorator() == 0 {
+			if cv := c.Value().ConstValue(); cv != nil {
+				return cv, nil
+			}
+		}
+
+	case t.FlagsUnaryOp:
+		x, err := e.expr(n.RHS().Expr())
+		if err != nil {
+			return nil, err
+		}
+		switch op.Key() {
+		case t.KeyXUnaryPlus:
+			return x, nil
+		case t.KeyXUnaryMinus:
+			return neg(x), nil
+		case t.KeyXUnaryNot:
+			return btoi(x.Sign() == 0), nil
+		}
+
+	case t.FlagsBinaryOp:
+		l, err := e.expr(n.LHS().Expr())
+		if err != nil {
+			return nil, err
+		}
+		switch op.Key() {
+		case t.KeyXBinaryAs:
+			b, err := e.typeBounds(n.RHS().TypeExpr())
+			if err != nil {
+				return nil, err
+			}
+			if l.Cmp(b[0]) < 0 || l.Cmp(b[1]) > 0 {
+				return nil, e.errorf("value %v of %q is not within [%v..%v]", l, n.Str(e.q.tm), b[0], b[1])
+			}
+			return l, nil
+		case t.KeyXBinaryAnd, t.KeyXBinaryOr:
+			// Short-circuit, as at run time.
+			if (l.Sign() != 0) == (op.Key() == t.KeyXBinaryOr) {
+				return btoi(l.Sign() != 0), nil
+			}
+		case t.KeyXBinaryTildePlus:
+			return nil, e.errorf("the %q operator is not supported", "~+")
+		}
+		r, err := e.expr(n.RHS().Expr())
+		if err != nil {
+			return nil, err
+		}
+		return evalConstValueBinaryOp(e.q.tm, n, l, r)
+
+	case t.FlagsAssociativeOp:
+		bin := a.NewExpr(0, op.AmbiguousForm().BinaryForm(), 0, 0, nil, nil, nil, nil)
+		ret := (*big.Int)(nil)
+		for _, o := range n.Args() {
+			x, err := e.expr(o.Expr())
+			if err != nil {
+				return nil, err
+			}
+			if ret == nil {
+				ret = x
+			} else if ret, err = evalConstValueBinaryOp(e.q.tm, bin, ret, x); err != nil {
+				return nil, err
+			}
+			// Short-circuit, as at run time.
+			switch bin.Operator().Key() {
+			case t.KeyXBinaryAnd:
+				if ret.Sign() == 0 {
+					return ret, nil
+				}
+			case t.KeyXBinaryOr:
+				if ret.Sign() != 0 {
+					return ret, nil
+				}
+			}
+		}
+		return ret, nil
+	}
+	return nil, e.errorf("%q is not a constant, parameter or local variable", n.Str(e.q.tm))
+}
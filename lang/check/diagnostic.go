@@ -0,0 +1,79 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is an Error or Warning in a form that can be rendered with its
+// source context.
+//
+// Nodes only record their line, not their column, so the span covers whole
+// lines, from Line to EndLine inclusive. An EndLine of zero means Line.
+type Diagnostic struct {
+	Message  string
+	Filename string
+	Line     uint32
+	EndLine  uint32
+}
+
+func (e *Error) Diagnostic() *Diagnostic {
+	return &Diagnostic{
+		Message:  e.Err.Error(),
+		Filename: e.Filename,
+		Line:     e.Line,
+	}
+}
+
+func (w *Warning) Diagnostic() *Diagnostic {
+	return &Diagnostic{
+		Message:  fmt.Sprintf("%v [%s]", w.Err, w.Category),
+		Filename: w.Filename,
+		Line:     w.Line,
+	}
+}
+
+// Render returns the diagnostic's message and location, followed by the
+// span's first line of src, the source file's contents, with a caret
+// underline. A multi-line span also notes the span's last line.
+//
+// The underline covers the line's text after any leading white space. If src
+// does not have that line, only the message and location are returned.
+func (d *Diagnostic) Render(src []byte) string {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s at %s:%d\n", d.Message, d.Filename, d.Line)
+
+	lines := bytes.Split(src, []byte("\n"))
+	if d.Line == 0 || int(d.Line) > len(lines) {
+		return b.String()
+	}
+	text := strings.TrimRight(string(lines[d.Line-1]), " \t\r")
+	indent := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+
+	num := strconv.Itoa(int(d.Line))
+	gutter := strings.Repeat(" ", len(num))
+	fmt.Fprintf(b, "%s | %s\n", num, text)
+	if n := len(text) - len(indent); n > 0 {
+		fmt.Fprintf(b, "%s | %s%s\n", gutter, indent, strings.Repeat("^", n))
+	}
+	if d.EndLine > d.Line {
+		fmt.Fprintf(b, "%s | ... (continues to line %d)\n", gutter, d.EndLine)
+	}
+	return b.String()
+}
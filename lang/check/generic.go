@@ -0,0 +1,298 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// typeParamMap maps from the QID that a type expression naming a type
+// parameter has, such as the "T" in "struct foo[T](x T)", to that parameter.
+type typeParamMap map[t.QID]*a.TypeParam
+
+// newTypeParamMap returns the type parameters, of a declaration in the pkg
+// package, keyed by their QIDs. It returns nil if there are no parameters.
+func newTypeParamMap(pkg t.ID, typeParams []*a.Node) typeParamMap {
+	if len(typeParams) == 0 {
+		return nil
+	}
+	m := typeParamMap{}
+	for _, o := range typeParams {
+		o := o.TypeParam()
+		m[t.QID{pkg, o.Name()}] = o
+	}
+	return m
+}
+
+// checkTypeParams checks the type parameters of decl, a generic struct or func
+// in the pkg package. Each parameter's name must be unique, must not also name
+// a type, must be used somewhere in decl and must have a known constraint, if
+// any.
+func (c *Checker) checkTypeParams(pkg t.ID, typeParams []*a.Node, decl *a.Node) error {
+	seen := map[t.ID]bool{}
+	for _, o := range typeParams {
+		name := o.TypeParam().Name()
+		if seen[name] {
+			return fmt.Errorf("check: duplicate type parameter %q", name.Str(c.tm))
+		}
+		seen[name] = true
+		if _, ok := builtInTypeMap[name]; ok || name.IsNumType() {
+			return fmt.Errorf("check: type parameter %q has the same name as a built-in type", name.Str(c.tm))
+		}
+		if _, ok := c.structs[t.QID{pkg, name}]; ok {
+			return fmt.Errorf("check: type parameter %q has the same name as a struct", name.Str(c.tm))
+		}
+		if k := o.TypeParam().Constraint(); k != 0 && !knownConstraints[k.Str(c.tm)] {
+			return fmt.Errorf("check: type parameter %q has unknown constraint %q", name.Str(c.tm), k.Str(c.tm))
+		}
+	}
+
+	used := map[t.ID]bool{}
+	decl.Walk(func(o *a.Node) error {
+		if o.Kind() == a.KTypeExpr {
+			if o := o.TypeExpr(); o.Decorator() == 0 && o.QID()[0] == pkg {
+				used[o.QID()[1]] = true
+			}
+		}
+		return nil
+	})
+	for _, o := range typeParams {
+		if name := o.TypeParam().Name(); !used[name] {
+			return fmt.Errorf("check: type parameter %q is not used", name.Str(c.tm))
+		}
+		o.SetTypeChecked()
+	}
+	return nil
+}
+
+// knownConstraints are the constraints that a type parameter can have, such as
+// the "numeric" in "T: numeric".
+//
+// TODO: allow constraining a type parameter to implement an interface, once
+// the language has interfaces.
+//
+// TODO: add a "ptr" constraint, once generic funcs can be instantiated. Only
+// structs can be instantiated for now, and struct fields cannot hold pointers.
+var knownConstraints = map[string]bool{
+	"numeric": true,
+	"struct":  true,
+}
+
+// satisfiesConstraint returns whether the type argument typ satisfies the
+// named constraint. Every type satisfies the zero constraint.
+func (c *Checker) satisfiesConstraint(typ *a.TypeExpr, constraint t.ID) bool {
+	switch constraint.Str(c.tm) {
+	case "":
+		return true
+	case "numeric":
+		return typ.IsNumType()
+	case "struct":
+		if typ.Decorator() != 0 {
+			return false
+		}
+		_, ok := c.structs[typ.QID()]
+		return ok
+	}
+	return false
+}
+
+// Instantiate returns the struct s, which must be generic, with its type
+// parameters replaced by the type arguments args throughout its fields'
+// types. For example, instantiating "struct ring_buffer[T](data [8] T)" with
+// "u8" gives "struct ring_buffer(data [8] u8)".
+//
+// Each type argument must satisfy its parameter's constraint, if any. The
+// instantiated struct is checked, and cached, so that instantiating the same
+// struct with the same type arguments gives the same *a.Struct.
+func (c *Checker) Instantiate(s *a.Struct, args []*a.TypeExpr) (*a.Struct, error) {
+	qid := s.QID()
+	typeParams := s.TypeParams()
+	if len(typeParams) == 0 {
+		return nil, fmt.Errorf("check: struct %s is not generic", qid.Str(c.tm))
+	}
+	if len(typeParams) != len(args) {
+		return nil, fmt.Errorf("check: struct %s has %d type parameters but %d type arguments were given",
+			qid.Str(c.tm), len(typeParams), len(args))
+	}
+	for i, o := range typeParams {
+		o := o.TypeParam()
+		if k := o.Constraint(); !c.satisfiesConstraint(args[i], k) {
+			return nil, fmt.Errorf("check: type argument %q does not satisfy the %q constraint of type parameter %q of struct %s",
+				args[i].Str(c.tm), k.Str(c.tm), o.Name().Str(c.tm), qid.Str(c.tm))
+		}
+	}
+
+	key := a.NewGenericTypeExpr(qid[0], qid[1], typeExprNodes(args)).Str(c.tm)
+	if ret := c.instantiations[key]; ret != nil {
+		return ret, nil
+	}
+
+	fields := substituteFields(s, args)
+	// TODO: set the package of a struct instantiated from a used package.
+	ret := a.NewStruct(s.Node().Raw().Flags()&^a.FlagsTypeChecked, s.Filename(), s.Line(), qid[1], nil, fields)
+	if err := c.checkFields(fields, nil, true, false); err != nil {
+		return nil, fmt.Errorf("%v in struct %s", err, key)
+	}
+	ret.Node().SetTypeChecked()
+
+	if c.instantiations == nil {
+		c.instantiations = map[string]*a.Struct{}
+	}
+	c.instantiations[key] = ret
+	return ret, nil
+}
+
+// substituteFields returns copies of the generic struct s's fields, with s's
+// type parameters replaced by args.
+func substituteFields(s *a.Struct, args []*a.TypeExpr) []*a.Node {
+	qid := s.QID()
+	m := map[t.QID]*a.TypeExpr{}
+	for i, o := range s.TypeParams() {
+		m[t.QID{qid[0], o.TypeParam().Name()}] = args[i]
+	}
+	fields := make([]*a.Node, len(s.Fields()))
+	for i, o := range s.Fields() {
+		o := o.Field()
+		fields[i] = a.NewField(0, o.Name(), substituteTypeExpr(o.XType(), m), o.DefaultValue()).Node()
+	}
+	return fields
+}
+
+func typeExprNodes(typs []*a.TypeExpr) []*a.Node {
+	ret := make([]*a.Node, len(typs))
+	for i, o := range typs {
+		ret[i] = o.Node()
+	}
+	return ret
+}
+
+// substituteTypeExpr returns typ with every type expression whose QID is a
+// key of m replaced by the corresponding value. It returns typ itself if
+// nothing was replaced.
+func substituteTypeExpr(typ *a.TypeExpr, m map[t.QID]*a.TypeExpr) *a.TypeExpr {
+	if typ == nil {
+		return nil
+	}
+	switch typ.Decorator().Key() {
+	case 0:
+		if len(typ.TypeArgs()) == 0 {
+			if o := m[typ.QID()]; o != nil && !typ.IsRefined() {
+				return o
+			}
+			return typ
+		}
+		changed := false
+		args := make([]*a.Node, len(typ.TypeArgs()))
+		for i, o := range typ.TypeArgs() {
+			x := substituteTypeExpr(o.TypeExpr(), m)
+			changed = changed || x != o.TypeExpr()
+			args[i] = x.Node()
+		}
+		if !changed {
+			return typ
+		}
+		qid := typ.QID()
+		return a.NewGenericTypeExpr(qid[0], qid[1], args)
+
+	case t.KeyOpenParen:
+		recv := substituteTypeExpr(typ.Receiver(), m)
+		if recv == typ.Receiver() {
+			return typ
+		}
+		return a.NewTypeExpr(typ.Decorator(), 0, typ.FuncName(), recv.Node(), nil, nil)
+	}
+
+	inner := substituteTypeExpr(typ.Inner(), m)
+	if inner == typ.Inner() {
+		return typ
+	}
+	qid := typ.QID()
+	return a.NewTypeExpr(typ.Decorator(), qid[0], qid[1], typ.Node().Raw().SubNodes()[0], typ.Max(), inner)
+}
+
+// tcheckGenericTypeExpr checks typ, an instantiation of a generic struct such
+// as "ring_buffer[u8]".
+func (q *checker) tcheckGenericTypeExpr(typ *a.TypeExpr, depth uint32) error {
+	s := q.c.structs[typ.QID()]
+	if s == nil {
+		return fmt.Errorf("check: %q is not a generic struct type", typ.Str(q.tm))
+	}
+	args := make([]*a.TypeExpr, len(typ.TypeArgs()))
+	for i, o := range typ.TypeArgs() {
+		o := o.TypeExpr()
+		if err := q.tcheckTypeExpr(o, depth); err != nil {
+			return err
+		}
+		args[i] = o
+	}
+	if len(q.typeParams) != 0 {
+		// Instantiating with type arguments that themselves refer to type
+		// parameters, such as "ring_buffer[T]" within a generic declaration,
+		// has to wait until that declaration is itself instantiated.
+		//
+		// TODO: check that such arguments' own constraints imply the
+		// constraints of s's type parameters.
+		for _, o := range args {
+			if q.refersToTypeParams(o) {
+				if len(args) != len(s.TypeParams()) {
+					return fmt.Errorf("check: struct %s has %d type parameters but %d type arguments were given",
+						s.QID().Str(q.tm), len(s.TypeParams()), len(args))
+				}
+				return nil
+			}
+		}
+	}
+	_, err := q.c.Instantiate(s, args)
+	return err
+}
+
+// refersToTypeParams returns whether typ refers to any of q's type parameters.
+func (q *checker) refersToTypeParams(typ *a.TypeExpr) bool {
+	found := false
+	typ.Node().Walk(func(o *a.Node) error {
+		if o.Kind() == a.KTypeExpr {
+			if _, ok := q.typeParams[o.TypeExpr().QID()]; ok {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// instantiateForDot returns the generic struct s instantiated with lTyp's type
+// arguments, so that a dot-expression such as "x.data" sees concrete field
+// types. Type arguments that refer to the type parameters of the declaration
+// being checked are substituted without checking the result.
+func (q *checker) instantiateForDot(s *a.Struct, lTyp *a.TypeExpr) (*a.Struct, error) {
+	args := make([]*a.TypeExpr, len(lTyp.TypeArgs()))
+	generic := false
+	for i, o := range lTyp.TypeArgs() {
+		args[i] = o.TypeExpr()
+		generic = generic || q.refersToTypeParams(args[i])
+	}
+	if !generic {
+		return q.c.Instantiate(s, args)
+	}
+	if len(args) != len(s.TypeParams()) {
+		return nil, fmt.Errorf("check: struct %s has %d type parameters but %d type arguments were given",
+			s.QID().Str(q.tm), len(s.TypeParams()), len(args))
+	}
+	fields := substituteFields(s, args)
+	return a.NewStruct(0, s.Filename(), s.Line(), s.QID()[1], nil, fields), nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// NamingConvention is a way to spell identifiers, such as "snake_case". The
+// zero value allows any spelling.
+type NamingConvention string
+
+const (
+	NamingAny                NamingConvention = ""
+	NamingSnakeCase          NamingConvention = "snake_case"
+	NamingScreamingSnakeCase NamingConvention = "SCREAMING_SNAKE_CASE"
+)
+
+// Valid returns whether c is a known NamingConvention.
+func (c NamingConvention) Valid() bool {
+	switch c {
+	case NamingAny, NamingSnakeCase, NamingScreamingSnakeCase:
+		return true
+	}
+	return false
+}
+
+// Matches returns whether the identifier s follows the convention c: one or
+// more words, separated by single underscores, where each word is lower case
+// (for snake_case) or upper case (for SCREAMING_SNAKE_CASE) letters and digits
+// and the first word starts with a letter.
+func (c NamingConvention) Matches(s string) bool {
+	lo, hi := byte(0), byte(0)
+	switch c {
+	case NamingSnakeCase:
+		lo, hi = 'a', 'z'
+	case NamingScreamingSnakeCase:
+		lo, hi = 'A', 'Z'
+	default:
+		return true
+	}
+	if s == "" || s[0] < lo || hi < s[0] || s[len(s)-1] == '_' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch x := s[i]; {
+		case lo <= x && x <= hi, '0' <= x && x <= '9':
+		case x == '_' && s[i-1] != '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NamingPolicy is the NamingConvention for each kind of declared identifier.
+// Fields include struct fields and func in- and out-params. Vars are local
+// variables.
+type NamingPolicy struct {
+	Consts  NamingConvention
+	Funcs   NamingConvention
+	Structs NamingConvention
+	Fields  NamingConvention
+	Vars    NamingConvention
+}
+
+// checkNaming warns about every declared identifier that does not follow the
+// policy, at the line that declares it.
+func (c *Checker) checkNaming(files []*a.File, policy *NamingPolicy) {
+	check := func(n *a.Node, kind string, name t.ID, convention NamingConvention) {
+		if s := name.Str(c.tm); !convention.Matches(s) {
+			filename, line := n.Raw().FilenameLine()
+			c.warnf(filename, line, WarningNaming,
+				"%s %q is not in %s, as the naming policy requires", kind, s, convention)
+		}
+	}
+	// Fields do not record their own line, so they are reported at that of
+	// their struct or func.
+	checkFields := func(decl *a.Node, fields []*a.Node) {
+		for _, o := range fields {
+			check(decl, "field", o.Field().Name(), policy.Fields)
+		}
+	}
+
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				check(n, "const", n.Const().QID()[1], policy.Consts)
+			case a.KFunc:
+				o := n.Func()
+				check(n, "func", o.FuncName(), policy.Funcs)
+				checkFields(n, o.In().Fields())
+				checkFields(n, o.Out().Fields())
+				o.Node().Walk(func(v *a.Node) error {
+					if v.Kind() == a.KVar {
+						check(v, "var", v.Var().Name(), policy.Vars)
+					}
+					return nil
+				})
+			case a.KStruct:
+				o := n.Struct()
+				check(n, "struct", o.QID()[1], policy.Structs)
+				checkFields(n, o.Fields())
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// assignedOuts is the set of out-parameters, keyed by name, that are
+// definitely assigned at a point in a function body. A nil assignedOuts means
+// that the point is unreachable, e.g. just after a return statement.
+type assignedOuts map[t.ID]bool
+
+func (s assignedOuts) clone() assignedOuts {
+	if s == nil {
+		return nil
+	}
+	ret := make(assignedOuts, len(s))
+	for k := range s {
+		ret[k] = true
+	}
+	return ret
+}
+
+// join returns the set of out-parameters that are assigned on both of two
+// control flow paths that meet.
+func (s assignedOuts) join(o assignedOuts) assignedOuts {
+	if s == nil {
+		return o
+	}
+	if o == nil {
+		return s
+	}
+	ret := assignedOuts{}
+	for k := range s {
+		if o[k] {
+			ret[k] = true
+		}
+	}
+	return ret
+}
+
+// assignedOut returns the name of the out-parameter that n assigns to, as in
+// "out.foo = etc", or zero if n is not such an assignment.
+func assignedOut(n *a.Assign) t.ID {
+	lhs := n.LHS()
+	if n.Operator().Key() != t.KeyEq || lhs.Operator().Key() != t.KeyDot {
+		return 0
+	}
+	if x := lhs.LHS().Expr(); x.Operator() != 0 || x.Ident().Key() != t.KeyOut {
+		return 0
+	}
+	return lhs.Ident()
+}
+
+// checkOutsAssigned checks that, in the by-reference style where a function
+// assigns "out.foo = etc" and then returns with a bare "return", every
+// out-parameter is assigned on every path that returns.
+//
+// Functions that never assign to "out" use the by-value style, "return x",
+// and are not checked. A "return x" statement, in either style, returns a
+// value, an error or a suspension and does not need the out-parameters to be
+// assigned.
+func (q *checker) checkOutsAssigned(n *a.Func) error {
+	outFields := n.Out().Fields()
+	if len(outFields) == 0 {
+		return nil
+	}
+	byReference := false
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if o.Kind() == a.KAssign && assignedOut(o.Assign()) != 0 {
+				byReference = true
+			}
+			return nil
+		})
+	}
+	if !byReference {
+		return nil
+	}
+	breaks := map[a.Loop]assignedOuts{}
+	s, err := q.outsAssignedBlock(outFields, breaks, assignedOuts{}, n.Body())
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		q.errFilename, q.errLine = n.Filename(), n.Line()
+		if err := q.checkOutsAssignedAt(outFields, s, "the end of the function"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *checker) checkOutsAssignedAt(outFields []*a.Node, s assignedOuts, where string) error {
+	for _, o := range outFields {
+		if name := o.Field().Name(); !s[name] {
+			return fmt.Errorf("check: out-parameter %q is not assigned before %s",
+				name.Str(q.tm), where)
+		}
+	}
+	return nil
+}
+
+// outsAssignedBlock returns the assigned out-parameters after block, given
+// those, s, before it. breaks accumulates, for each loop, the join of the
+// states at that loop's break statements.
+func (q *checker) outsAssignedBlock(outFields []*a.Node, breaks map[a.Loop]assignedOuts,
+	s assignedOuts, block []*a.Node) (assignedOuts, error) {
+	for _, o := range block {
+		if s == nil {
+			break
+		}
+		q.errFilename, q.errLine = o.Raw().FilenameLine()
+
+		switch o.Kind() {
+		case a.KAssign:
+			if name := assignedOut(o.Assign()); name != 0 {
+				s = s.clone()
+				s[name] = true
+			}
+
+		case a.KIf:
+			joined := assignedOuts(nil)
+			for o := o.If(); o != nil; o = o.ElseIf() {
+				x, err := q.outsAssignedBlock(outFields, breaks, s.clone(), o.BodyIfTrue())
+				if err != nil {
+					return nil, err
+				}
+				joined = joined.join(x)
+				if o.ElseIf() == nil {
+					x, err := q.outsAssignedBlock(outFields, breaks, s.clone(), o.BodyIfFalse())
+					if err != nil {
+						return nil, err
+					}
+					joined = joined.join(x)
+				}
+			}
+			s = joined
+
+		case a.KIterate, a.KWhile:
+			// The loop is left either when its condition is false, possibly
+			// before the body runs at all, so that s is unchanged, or by a
+			// break. A "while true" loop is only left by a break, so that,
+			// if it has none, the code after it is unreachable.
+			loop, body, forever := a.Loop(nil), []*a.Node(nil), false
+			if o.Kind() == a.KIterate {
+				loop, body = o.Iterate(), o.Iterate().Body()
+			} else {
+				loop, body = o.While(), o.While().Body()
+				cv := o.While().Condition().ConstValue()
+				forever = cv != nil && cv.Sign() != 0
+			}
+			breaks[loop] = nil
+			if _, err := q.outsAssignedBlock(outFields, breaks, s.clone(), body); err != nil {
+				return nil, err
+			}
+			if forever {
+				s = breaks[loop]
+			} else {
+				s = s.join(breaks[loop])
+			}
+
+		case a.KJump:
+			if o := o.Jump(); o.Keyword().Key() == t.KeyBreak {
+				breaks[o.JumpTarget()] = breaks[o.JumpTarget()].join(s)
+			}
+			s = nil
+
+		case a.KRet:
+			if o.Ret().Value() == nil {
+				if err := q.checkOutsAssignedAt(outFields, s, "return"); err != nil {
+					return nil, err
+				}
+			}
+			s = nil
+		}
+	}
+	return s, nil
+}
@@ -38,6 +38,7 @@ var (
 	typeExprIdeal   = a.NewTypeExpr(0, 0, t.IDDoubleZ, nil, nil, nil)
 	typeExprList    = a.NewTypeExpr(0, 0, t.IDDollar, nil, nil, nil)
 
+	typeExprI8          = a.NewTypeExpr(0, 0, t.IDI8, nil, nil, nil)
 	typeExprU8          = a.NewTypeExpr(0, 0, t.IDU8, nil, nil, nil)
 	typeExprU16         = a.NewTypeExpr(0, 0, t.IDU16, nil, nil, nil)
 	typeExprU32         = a.NewTypeExpr(0, 0, t.IDU32, nil, nil, nil)
@@ -0,0 +1,122 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// ObligationKind is a kind of safety obligation, something that the bounds
+// checker has to prove, such as an array index being in bounds.
+type ObligationKind int
+
+const (
+	ObligationArrayBound ObligationKind = iota
+	ObligationOverflow
+	ObligationDivisorNonZero
+	ObligationPrecondition
+	ObligationRange
+
+	NumObligationKinds
+)
+
+func (k ObligationKind) String() string {
+	switch k {
+	case ObligationArrayBound:
+		return "array-bound"
+	case ObligationOverflow:
+		return "overflow"
+	case ObligationDivisorNonZero:
+		return "divisor-nonzero"
+	case ObligationPrecondition:
+		return "precondition"
+	case ObligationRange:
+		return "range"
+	}
+	return "unknown"
+}
+
+// FuncSafety counts a function's safety obligations, indexed by kind.
+//
+// An obligation that the bounds checker fails to prove is an error, so a
+// successful check has no disproven obligations. Unproven obligations are
+// those that the bounds checker does not (yet) attempt to prove, such as a
+// callee's "pre" condition that cannot be restated in the caller's terms.
+// Runtime-checked obligations are those that the author asked to be checked
+// at run time instead of proven, such as an "assume_in_bounds(x:etc, lo:etc,
+// hi:etc)" that the bounds checker could not prove.
+type FuncSafety struct {
+	Func           t.QQID
+	Filename       string
+	Line           uint32
+	Proven         [NumObligationKinds]int
+	Unproven       [NumObligationKinds]int
+	RuntimeChecked [NumObligationKinds]int
+}
+
+// SafetyReport returns the safety obligation counts for each checked function,
+// sorted by filename and line.
+func (c *Checker) SafetyReport() []FuncSafety {
+	ret := make([]FuncSafety, 0, len(c.safety))
+	for _, s := range c.safety {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Filename != ret[j].Filename {
+			return ret[i].Filename < ret[j].Filename
+		}
+		return ret[i].Line < ret[j].Line
+	})
+	return ret
+}
+
+func (c *Checker) funcSafety(f *a.Func) *FuncSafety {
+	qqid := f.QQID()
+	s := c.safety[qqid]
+	if s == nil {
+		s = &FuncSafety{
+			Func:     qqid,
+			Filename: f.Filename(),
+			Line:     f.Line(),
+		}
+		if c.safety == nil {
+			c.safety = map[t.QQID]*FuncSafety{}
+		}
+		c.safety[qqid] = s
+	}
+	return s
+}
+
+func (q *checker) recordObligation(k ObligationKind, proven bool) {
+	if q.astFunc == nil {
+		return
+	}
+	s := q.c.funcSafety(q.astFunc)
+	if proven {
+		s.Proven[k]++
+	} else {
+		s.Unproven[k]++
+	}
+}
+
+func (q *checker) recordRuntimeCheck(k ObligationKind) {
+	if q.astFunc == nil {
+		return
+	}
+	q.c.funcSafety(q.astFunc).RuntimeChecked[k]++
+}
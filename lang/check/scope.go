@@ -0,0 +1,121 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Scope is the set of variables visible at some point in a function: its
+// arguments, such as "in" and "out", and its local variables.
+//
+// A Scope is a stack of frames, each of which can declare variables. Looking
+// up a variable walks the frames from the innermost outward.
+//
+// Local variables have function scope, so they are all declared in the
+// outermost frame. The checker pushes a frame for each if, while or iterate
+// body, so that per-body state, such as a variable's narrowed type, can be
+// added to frames once the checker tracks it.
+//
+// A nil *Scope is valid, and has no variables.
+type Scope struct {
+	frames []*scopeFrame
+}
+
+type scopeFrame struct {
+	// declared are those variables declared in this frame, and the types
+	// that they were declared with.
+	declared typeMap
+}
+
+// NewScope returns a Scope with a single, empty frame.
+func NewScope() *Scope {
+	s := &Scope{}
+	s.Push()
+	return s
+}
+
+// Push adds a new, empty, innermost frame.
+func (s *Scope) Push() {
+	s.frames = append(s.frames, &scopeFrame{})
+}
+
+// Pop removes the innermost frame, discarding the variables that it declared.
+// The outermost frame cannot be popped.
+func (s *Scope) Pop() {
+	if len(s.frames) <= 1 {
+		panic("check: internal error: popping the outermost scope frame")
+	}
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+// Depth returns the number of frames.
+func (s *Scope) Depth() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.frames)
+}
+
+// Declare adds a variable to the innermost frame. It returns false, and does
+// nothing, if that frame already declares a variable with that name.
+func (s *Scope) Declare(name t.ID, typ *a.TypeExpr) bool {
+	f := s.frames[len(s.frames)-1]
+	if _, ok := f.declared[name]; ok {
+		return false
+	}
+	if f.declared == nil {
+		f.declared = typeMap{}
+	}
+	f.declared[name] = typ
+	return true
+}
+
+// Declared returns whether any frame declares a variable with that name.
+func (s *Scope) Declared(name t.ID) bool {
+	_, ok := s.Lookup(name)
+	return ok
+}
+
+// Lookup returns the type that the named variable was declared with, in the
+// innermost frame that declares it.
+func (s *Scope) Lookup(name t.ID) (*a.TypeExpr, bool) {
+	if s == nil {
+		return nil, false
+	}
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		if typ, ok := s.frames[i].declared[name]; ok {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+// Vars returns the types of all of the visible variables, keyed by name. A
+// variable declared in an inner frame shadows one of the same name in an
+// outer frame.
+func (s *Scope) Vars() typeMap {
+	ret := typeMap{}
+	if s == nil {
+		return ret
+	}
+	for _, f := range s.frames {
+		for name, typ := range f.declared {
+			ret[name] = typ
+		}
+	}
+	return ret
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// tcheckSizeof checks "sizeof(T)", whose value is the constant size, in
+// bytes, of a T.
+func (q *checker) tcheckSizeof(n *a.Expr) error {
+	typ := n.RHS().TypeExpr()
+	if err := q.tcheckTypeExpr(typ, 0); err != nil {
+		return err
+	}
+	size, _, err := q.sizeOf(typ)
+	if err != nil {
+		return fmt.Errorf("check: size cannot be computed for %q: %v", n.Str(q.tm), err)
+	}
+	n.SetConstValue(size)
+	n.SetMType(typeExprIdeal)
+	return nil
+}
+
+// sizeOf returns the size and alignment, in bytes, of a typ, whose C layout
+// is that of the C code that cgen generates. Numeric types are their C
+// integer types, arrays are C arrays and a non-suspendible struct is a C
+// struct of its fields, in order, each aligned to its own alignment.
+//
+// The size of any other type is not computed. Slices, pointers, reader1 and
+// writer1 are pointer-sized, which depends on the platform, as does usize. A
+// suspendible struct's C struct also has a status, a magic number and
+// coroutine state. A generic type's size depends on its type arguments.
+func (q *checker) sizeOf(typ *a.TypeExpr) (size *big.Int, align int64, err error) {
+	switch typ.Decorator().Key() {
+	case 0:
+		// No-op.
+	case t.KeyOpenBracket:
+		size, align, err := q.sizeOf(typ.Inner())
+		if err != nil {
+			return nil, 0, err
+		}
+		return size.Mul(size, typ.ArrayLength().ConstValue()), align, nil
+	case t.KeyColon:
+		return nil, 0, fmt.Errorf("%q is a slice", typ.Str(q.tm))
+	default:
+		return nil, 0, fmt.Errorf("%q is a pointer", typ.Str(q.tm))
+	}
+
+	qid := typ.QID()
+	if _, ok := q.typeParams[qid]; ok {
+		return nil, 0, fmt.Errorf("%q is a type parameter", typ.Str(q.tm))
+	}
+	if len(typ.TypeArgs()) != 0 {
+		return nil, 0, fmt.Errorf("%q is a generic type", typ.Str(q.tm))
+	}
+	if qid[0] == 0 {
+		x := int64(0)
+		switch qid[1].Key() {
+		case t.KeyI8, t.KeyU8:
+			x = 1
+		case t.KeyI16, t.KeyU16:
+			x = 2
+		case t.KeyI32, t.KeyU32:
+			x = 4
+		case t.KeyI64, t.KeyU64:
+			x = 8
+		}
+		if x != 0 {
+			return big.NewInt(x), x, nil
+		}
+	}
+	s := q.c.structs[qid]
+	if s == nil {
+		return nil, 0, fmt.Errorf("%q's size depends on the platform or on another package", typ.Str(q.tm))
+	}
+	if s.Suspendible() {
+		return nil, 0, fmt.Errorf("%q is a suspendible struct", typ.Str(q.tm))
+	}
+	if q.c.sizing[s] {
+		return nil, 0, fmt.Errorf("%q's size depends on itself", typ.Str(q.tm))
+	}
+	if q.c.sizing == nil {
+		q.c.sizing = map[*a.Struct]bool{}
+	}
+	q.c.sizing[s] = true
+	defer delete(q.c.sizing, s)
+
+	// This runs before, or while, the struct's fields are checked, so check
+	// their types here, e.g. to give an array length its ConstValue.
+	fq := &checker{
+		c:  q.c,
+		tm: q.tm,
+	}
+	offset, align := big.NewInt(0), int64(1)
+	for _, o := range s.Fields() {
+		fTyp := o.Field().XType()
+		if err := fq.tcheckTypeExpr(fTyp, 0); err != nil {
+			return nil, 0, err
+		}
+		fSize, fAlign, err := fq.sizeOf(fTyp)
+		if err != nil {
+			return nil, 0, err
+		}
+		alignUp(offset, fAlign)
+		offset.Add(offset, fSize)
+		if align < fAlign {
+			align = fAlign
+		}
+	}
+	return alignUp(offset, align), align, nil
+}
+
+// alignUp rounds x up to a multiple of align, in place, and returns x.
+func alignUp(x *big.Int, align int64) *big.Int {
+	mask := big.NewInt(align - 1)
+	x.Add(x, mask)
+	return x.AndNot(x, mask)
+}
@@ -0,0 +1,337 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// bufferSlices is the set of local variables, keyed by name, that hold slices
+// derived from a reader1 or writer1 buffer, such as the result of
+// "in.dst.since_mark()", at a point in a function body. The value is whether
+// that slice may have been invalidated by an intervening suspension, when the
+// caller can refill or flush the buffer. A nil bufferSlices means that the
+// point is unreachable, e.g. just after a return statement.
+type bufferSlices map[t.ID]bool
+
+func (s bufferSlices) clone() bufferSlices {
+	if s == nil {
+		return nil
+	}
+	ret := make(bufferSlices, len(s))
+	for k, v := range s {
+		ret[k] = v
+	}
+	return ret
+}
+
+// join returns the state where two control flow paths meet: a variable holds
+// a buffer-derived slice if it does on either path, and that slice may be
+// invalidated if it may be on either path.
+func (s bufferSlices) join(o bufferSlices) bufferSlices {
+	if s == nil {
+		return o.clone()
+	}
+	if o == nil {
+		return s.clone()
+	}
+	ret := s.clone()
+	for k, v := range o {
+		ret[k] = ret[k] || v
+	}
+	return ret
+}
+
+func (s bufferSlices) equal(o bufferSlices) bool {
+	if (s == nil) != (o == nil) || len(s) != len(o) {
+		return false
+	}
+	for k, v := range s {
+		if w, ok := o[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// suspend returns the state after a suspension point: every buffer-derived
+// slice may be invalidated.
+func (s bufferSlices) suspend() bufferSlices {
+	if len(s) == 0 {
+		return s
+	}
+	ret := make(bufferSlices, len(s))
+	for k := range s {
+		ret[k] = true
+	}
+	return ret
+}
+
+// sliceChecker checks that a suspendible function does not use a slice derived
+// from a reader1 or writer1 buffer after a suspension point, without
+// re-deriving it first.
+//
+// With pointerLocals set, it instead checks the same for every local variable
+// whose type holds pointers, such as any slice. The coroutine state saves and
+// restores the other locals across a suspension, but not those, which are
+// zeroed when the function resumes.
+type sliceChecker struct {
+	q             *checker
+	breaks        map[a.Loop]bufferSlices
+	continues     map[a.Loop]bufferSlices
+	pointerLocals bool
+}
+
+func (q *checker) checkBufferSlices(n *a.Func) error {
+	if !n.Suspendible() {
+		return nil
+	}
+	for _, pointerLocals := range [...]bool{false, true} {
+		c := &sliceChecker{
+			q:             q,
+			breaks:        map[a.Loop]bufferSlices{},
+			continues:     map[a.Loop]bufferSlices{},
+			pointerLocals: pointerLocals,
+		}
+		if _, err := c.block(bufferSlices{}, n.Body()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *sliceChecker) block(s bufferSlices, block []*a.Node) (bufferSlices, error) {
+	for _, o := range block {
+		if s == nil {
+			break
+		}
+		c.q.errFilename, c.q.errLine = o.Raw().FilenameLine()
+
+		var err error
+		switch o.Kind() {
+		case a.KAssign:
+			o := o.Assign()
+			lhs := o.LHS()
+			if o.Operator().Key() == t.KeyEq && lhs.Operator() == 0 {
+				s, err = c.assign(s, lhs.Ident(), o.RHS())
+			} else {
+				if err = c.use(s, lhs); err == nil {
+					s, err = c.expr(s, o.RHS())
+				}
+			}
+
+		case a.KExpr:
+			s, err = c.expr(s, o.Expr())
+
+		case a.KIf:
+			joined := bufferSlices(nil)
+			for o := o.If(); o != nil; o = o.ElseIf() {
+				if s, err = c.expr(s, o.Condition()); err != nil {
+					return nil, err
+				}
+				x, err := c.block(s.clone(), o.BodyIfTrue())
+				if err != nil {
+					return nil, err
+				}
+				joined = joined.join(x)
+				if o.ElseIf() == nil {
+					x, err := c.block(s.clone(), o.BodyIfFalse())
+					if err != nil {
+						return nil, err
+					}
+					joined = joined.join(x)
+				}
+			}
+			s = joined
+
+		case a.KIterate:
+			for _, v := range o.Iterate().Variables() {
+				v := v.Var()
+				if s, err = c.assign(s, v.Name(), v.Value()); err != nil {
+					return nil, err
+				}
+			}
+			s, err = c.loop(s, o.Iterate(), nil)
+
+		case a.KWhile:
+			s, err = c.loop(s, o.While(), o.While().Condition())
+
+		case a.KJump:
+			o := o.Jump()
+			if o.Keyword().Key() == t.KeyBreak {
+				c.breaks[o.JumpTarget()] = c.breaks[o.JumpTarget()].join(s)
+			} else {
+				c.continues[o.JumpTarget()] = c.continues[o.JumpTarget()].join(s)
+			}
+			s = nil
+
+		case a.KRet:
+			o := o.Ret()
+			if v := o.Value(); v != nil {
+				s, err = c.expr(s, v)
+			}
+			if o.Keyword().Key() == t.KeyYield {
+				// The function resumes after the yield.
+				s = s.suspend()
+			} else {
+				s = nil
+			}
+
+		case a.KVar:
+			o := o.Var()
+			if v := o.Value(); v != nil {
+				s, err = c.assign(s, o.Name(), v)
+			} else {
+				s = s.clone()
+				delete(s, o.Name())
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loop checks a while or iterate loop, whose body can run any number of times,
+// by re-checking the body until the state at the top of the loop stops
+// changing. That terminates, as each re-check can only add variables or mark
+// them as possibly invalidated.
+func (c *sliceChecker) loop(s bufferSlices, n a.Loop, cond *a.Expr) (bufferSlices, error) {
+	head, exit := s, bufferSlices(nil)
+	for {
+		x := head
+		if cond != nil {
+			var err error
+			if x, err = c.expr(x, cond); err != nil {
+				return nil, err
+			}
+		}
+		exit = x
+		c.breaks[n], c.continues[n] = nil, nil
+		out, err := c.block(x.clone(), n.Body())
+		if err != nil {
+			return nil, err
+		}
+		next := head.join(out).join(c.continues[n])
+		if next.equal(head) {
+			break
+		}
+		head = next
+	}
+	return exit.join(c.breaks[n]), nil
+}
+
+// assign checks the statement "name = value", or "var name T = value".
+func (c *sliceChecker) assign(s bufferSlices, name t.ID, value *a.Expr) (bufferSlices, error) {
+	derived := c.derived(s, value)
+	s, err := c.expr(s, value)
+	if err != nil || s == nil {
+		return s, err
+	}
+	s = s.clone()
+	if derived {
+		s[name] = false
+	} else {
+		delete(s, name)
+	}
+	return s, nil
+}
+
+// expr checks that n does not use a possibly invalidated slice, and returns
+// the state after evaluating n, which is a suspension point if n contains a
+// suspendible call that might suspend. A "try" call is not: it returns the
+// callee's status instead of suspending the caller.
+func (c *sliceChecker) expr(s bufferSlices, n *a.Expr) (bufferSlices, error) {
+	if err := c.use(s, n); err != nil {
+		return nil, err
+	}
+	suspends := false
+	n.Node().Walk(func(o *a.Node) error {
+		if o.Kind() == a.KExpr {
+			if o := o.Expr(); o.CallSuspendible() && o.Operator().Key() != t.KeyTry &&
+				!o.ProvenNotToSuspend() {
+				suspends = true
+			}
+		}
+		return nil
+	})
+	if suspends {
+		s = s.suspend()
+	}
+	return s, nil
+}
+
+func (c *sliceChecker) use(s bufferSlices, n *a.Expr) error {
+	return n.Node().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.Expr()
+		if x.Operator() != 0 || !s[x.Ident()] {
+			return nil
+		}
+		if c.pointerLocals {
+			return fmt.Errorf("check: local variable %q, of type %q, is used after a suspension point "+
+				"but is not saved in the coroutine state, as its type holds pointers; "+
+				"assign it again after the suspension point", x.Ident().Str(c.q.tm), x.MType().Str(c.q.tm))
+		}
+		return fmt.Errorf("check: slice %q may be invalidated by suspension; "+
+			"derive it again after the suspension point", x.Ident().Str(c.q.tm))
+	})
+}
+
+// derived returns whether n is a slice derived from a reader1 or writer1
+// buffer: a since_mark call, a variable holding such a slice, or a sub-slice
+// of either, such as "x[i:j]" or "x.prefix(up_to:k)".
+//
+// Only the slice operand is followed, not any index or argument, so that
+// "this.t[0:x.length()]" is not derived from x.
+func (c *sliceChecker) derived(s bufferSlices, n *a.Expr) bool {
+	if c.pointerLocals {
+		return n != nil && n.MType().HasPointers()
+	}
+	for n != nil && n.MType().IsSliceType() {
+		switch n.Operator().Key() {
+		case 0:
+			_, ok := s[n.Ident()]
+			return ok
+
+		case t.KeyColon:
+			n = n.LHS().Expr()
+
+		case t.KeyOpenParen:
+			f := n.LHS().Expr()
+			if f.Operator().Key() != t.KeyDot {
+				return false
+			}
+			recv := f.LHS().Expr()
+			if typ := recv.MType(); f.Ident().Key() == t.KeySinceMark && typ.Decorator() == 0 {
+				switch typ.QID()[1].Key() {
+				case t.KeyReader1, t.KeyWriter1:
+					return true
+				}
+			}
+			n = recv
+
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -50,13 +50,18 @@ func (q *checker) tcheckVars(block []*a.Node) error {
 		case a.KVar:
 			o := o.Var()
 			name := o.Name()
-			if _, ok := q.localVars[name]; ok {
+			if q.scope.Declared(name) {
 				return fmt.Errorf("check: duplicate var %q", name.Str(q.tm))
 			}
+			if o.XType() == nil {
+				if err := q.inferVarType(o); err != nil {
+					return err
+				}
+			}
 			if err := q.tcheckTypeExpr(o.XType(), 0); err != nil {
 				return err
 			}
-			q.localVars[name] = o.XType()
+			q.scope.Declare(name, o.XType())
 
 		case a.KWhile:
 			if err := q.tcheckVars(o.While().Body()); err != nil {
@@ -67,6 +72,31 @@ func (q *checker) tcheckVars(block []*a.Node) error {
 	return nil
 }
 
+// inferVarType sets the type of a "var x = etc" declaration, which has no
+// explicit type, to the (unrefined) type of its initializer. The initializer
+// can only refer to those local variables declared before it.
+func (q *checker) inferVarType(n *a.Var) error {
+	value := n.Value()
+	if value == nil {
+		return fmt.Errorf("check: cannot infer the type of var %q without an initializer",
+			n.Name().Str(q.tm))
+	}
+	if err := q.tcheckExpr(value, 0); err != nil {
+		return err
+	}
+	typ := value.MType()
+	if typ.IsIdeal() {
+		return fmt.Errorf("check: cannot infer the type of var %q from the ideal constant %q",
+			n.Name().Str(q.tm), value.Str(q.tm))
+	}
+	if typ == typeExprPlaceholder {
+		return fmt.Errorf("check: cannot infer the type of var %q from %q, which has no value",
+			n.Name().Str(q.tm), value.Str(q.tm))
+	}
+	n.SetXType(typ.Unrefined())
+	return nil
+}
+
 func (q *checker) tcheckStatement(n *a.Node) error {
 	q.errFilename, q.errLine = n.Raw().FilenameLine()
 
@@ -82,27 +112,34 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 		}
 
 	case a.KExpr:
-		return q.tcheckExpr(n.Expr(), 0)
+		n := n.Expr()
+		if err := q.tcheckExpr(n, 0); err != nil {
+			return err
+		}
+		// An expression statement is only worth evaluating for its side
+		// effects, so it must be an impure or suspendible call.
+		if n.Operator().Key() != t.KeyOpenParen || !(n.Impure() || n.Suspendible()) {
+			return fmt.Errorf("check: expression result is unused for %q", n.Str(q.tm))
+		}
+		return nil
 
 	case a.KIf:
 		for n := n.If(); n != nil; n = n.ElseIf() {
 			cond := n.Condition()
-			if err := q.tcheckExpr(cond, 0); err != nil {
+			q.inCondition = true
+			err := q.tcheckExpr(cond, 0)
+			q.inCondition = false
+			if err != nil {
 				return err
 			}
 			if !cond.MType().IsBool() {
-				return fmt.Errorf("check: if condition %q, of type %q, does not have a boolean type",
-					cond.Str(q.tm), cond.MType().Str(q.tm))
+				return q.errNotBool("if", cond)
 			}
-			for _, o := range n.BodyIfTrue() {
-				if err := q.tcheckStatement(o); err != nil {
-					return err
-				}
+			if err := q.tcheckBlock(n.BodyIfTrue()); err != nil {
+				return err
 			}
-			for _, o := range n.BodyIfFalse() {
-				if err := q.tcheckStatement(o); err != nil {
-					return err
-				}
+			if err := q.tcheckBlock(n.BodyIfFalse()); err != nil {
+				return err
 			}
 		}
 		for n := n.If(); n != nil; n = n.ElseIf() {
@@ -120,7 +157,10 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			return fmt.Errorf("check: unroll count %q is not constant", unroll.Str(q.tm))
 		}
 		for _, o := range n.Variables() {
-			if err := q.tcheckStatement(o); err != nil {
+			q.inCondition = true
+			err := q.tcheckStatement(o)
+			q.inCondition = false
+			if err != nil {
 				return err
 			}
 		}
@@ -135,6 +175,10 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			for i := len(q.jumpTargets) - 1; i >= 0; i-- {
 				if w := q.jumpTargets[i]; w.Label() == id {
 					jumpTarget = w
+					if q.usedLabels == nil {
+						q.usedLabels = map[a.Loop]bool{}
+					}
+					q.usedLabels[w] = true
 					break
 				}
 			}
@@ -146,7 +190,7 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			if id := n.Label(); id != 0 {
 				sepStr, labelStr = ":", id.Str(q.tm)
 			}
-			return fmt.Errorf("no matching while/iterate statement for %s%s%s",
+			return fmt.Errorf("check: no matching while/iterate statement for %s%s%s",
 				n.Keyword().Str(q.tm), sepStr, labelStr)
 		}
 		if n.Keyword().Key() == t.KeyBreak {
@@ -172,6 +216,9 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			return fmt.Errorf("check: internal error: unchecked type expression %q", n.XType().Str(q.tm))
 		}
 		if value := n.Value(); value != nil {
+			if _, ok := strLiteralLength(q.tm, value); ok && isArrayOfU8(n.XType()) {
+				q.strLiteral = value
+			}
 			if err := q.tcheckExpr(value, 0); err != nil {
 				return err
 			}
@@ -191,6 +238,11 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 						"as their inner types don't match",
 						n.Name().Str(q.tm), lTyp.Str(q.tm), value.Str(q.tm), rTyp.Str(q.tm))
 				}
+			} else if length, ok := strLiteralLength(q.tm, value); ok && isArrayOfU8(lTyp) {
+				if cv := lTyp.ArrayLength().ConstValue(); cv.Cmp(big.NewInt(int64(length))) != 0 {
+					return fmt.Errorf("check: cannot initialize %q, of type %q, from %q of length %d",
+						n.Name().Str(q.tm), lTyp.Str(q.tm), value.Str(q.tm), length)
+				}
 			} else if err := q.tcheckEq(n.Name(), nil, lTyp, value, rTyp); err != nil {
 				return err
 			}
@@ -202,12 +254,14 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 	case a.KWhile:
 		n := n.While()
 		cond := n.Condition()
-		if err := q.tcheckExpr(cond, 0); err != nil {
+		q.inCondition = true
+		err := q.tcheckExpr(cond, 0)
+		q.inCondition = false
+		if err != nil {
 			return err
 		}
 		if !cond.MType().IsBool() {
-			return fmt.Errorf("check: for-loop condition %q, of type %q, does not have a boolean type",
-				cond.Str(q.tm), cond.MType().Str(q.tm))
+			return q.errNotBool("for-loop", cond)
 		}
 		if err := q.tcheckLoop(n); err != nil {
 			return err
@@ -223,12 +277,14 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 
 func (q *checker) tcheckAssert(n *a.Assert) error {
 	cond := n.Condition()
-	if err := q.tcheckExpr(cond, 0); err != nil {
+	q.inAssert = true
+	err := q.tcheckExpr(cond, 0)
+	q.inAssert = false
+	if err != nil {
 		return err
 	}
 	if !cond.MType().IsBool() {
-		return fmt.Errorf("check: assert condition %q, of type %q, does not have a boolean type",
-			cond.Str(q.tm), cond.MType().Str(q.tm))
+		return q.errNotBool("assert", cond)
 	}
 	for _, o := range n.Args() {
 		if err := q.tcheckExpr(o.Arg().Value(), 0); err != nil {
@@ -240,6 +296,43 @@ func (q *checker) tcheckAssert(n *a.Assert) error {
 	return nil
 }
 
+// tcheckResult checks n, the identifier "result" in a function's post
+// condition, which is shorthand for "out.x" when x is the function's only
+// out-param. A local variable or const named "result" takes precedence.
+func (q *checker) tcheckResult(n *a.Expr) error {
+	if !q.inFuncPost {
+		return fmt.Errorf("check: %q can only be used in a function's post condition", n.Str(q.tm))
+	}
+	fields := q.astFunc.Out().Fields()
+	if len(fields) != 1 {
+		return fmt.Errorf("check: %q needs func %s to have exactly one out-param, but it has %d; "+
+			"refer to an out-param as \"out.name\" instead", n.Str(q.tm), q.astFunc.QQID().Str(q.tm), len(fields))
+	}
+	n.SetMType(fields[0].Field().XType())
+	return nil
+}
+
+// errNotBool reports that an if, for-loop or assert condition does not have a
+// boolean type. Numbers and pointers are not implicitly true or false, as
+// they are in C, so for those, the error suggests an explicit test.
+func (q *checker) errNotBool(kind string, cond *a.Expr) error {
+	typ := cond.MType()
+	err := fmt.Errorf("check: %s condition %q, of type %q, does not have a boolean type",
+		kind, cond.Str(q.tm), typ.Str(q.tm))
+	switch {
+	case typ.IsNumTypeOrIdeal():
+		s := cond.Str(q.tm)
+		if op := cond.Operator(); op.IsBinaryOp() || op.IsAssociativeOp() {
+			s = "(" + s + ")"
+		}
+		return fmt.Errorf("%v; a number is not implicitly true when non-zero, so write \"%s != 0\" instead",
+			err, s)
+	case typ.Decorator().Key() == t.KeyPtr:
+		return fmt.Errorf("%v; a ptr is never null, so it does not need testing", err)
+	}
+	return err
+}
+
 func (q *checker) tcheckEq(lID t.ID, lhs *a.Expr, lTyp *a.TypeExpr, rhs *a.Expr, rTyp *a.TypeExpr) error {
 	if (rTyp.IsIdeal() && lTyp.IsNumType()) || lTyp.EqIgnoringRefinements(rTyp) {
 		return nil
@@ -257,9 +350,19 @@ func (q *checker) tcheckEq(lID t.ID, lhs *a.Expr, lTyp *a.TypeExpr, rhs *a.Expr,
 func (q *checker) tcheckAssign(n *a.Assign) error {
 	lhs := n.LHS()
 	rhs := n.RHS()
+	// The parser never builds a chain like "a = b = c", but other code that
+	// builds an AST might.
+	if o := rhs.Node(); o.Kind() == a.KAssign {
+		return fmt.Errorf("check: assignment to %q has another assignment, to %q, as its value; "+
+			"assignment is a statement, not an expression, so split it into two statements",
+			lhs.Str(q.tm), o.Assign().LHS().Str(q.tm))
+	}
 	if err := q.tcheckExpr(lhs, 0); err != nil {
 		return err
 	}
+	if err := q.checkInParamAssign(lhs); err != nil {
+		return err
+	}
 	if err := q.tcheckExpr(rhs, 0); err != nil {
 		return err
 	}
@@ -299,6 +402,44 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 	)
 }
 
+// checkInParamAssign rejects assigning to lhs if it is "in.x", or an element
+// or field of it such as "in.x[i]" or "in.x[i].f", for an in-param x that is
+// not marked mutable, as "var x T".
+func (q *checker) checkInParamAssign(lhs *a.Expr) error {
+	if q.astFunc == nil {
+		return nil
+	}
+	root := lhs
+	for {
+		switch root.Operator().Key() {
+		case t.KeyOpenBracket:
+			root = root.LHS().Expr()
+			continue
+		case t.KeyDot:
+			if l := root.LHS().Expr(); l.Operator() != 0 || l.Ident().Key() != t.KeyIn {
+				root = l
+				continue
+			}
+		default:
+			return nil
+		}
+		break
+	}
+	for _, o := range q.astFunc.In().Fields() {
+		o := o.Field()
+		if o.Name() != root.Ident() || o.Mutable() {
+			continue
+		}
+		if root != lhs {
+			return fmt.Errorf("check: cannot assign to %q, part of in-parameter %q; "+
+				"declare it as \"var %s\" to allow this", lhs.Str(q.tm), root.Str(q.tm), o.Name().Str(q.tm))
+		}
+		return fmt.Errorf("check: cannot assign to in-parameter %q; declare it as \"var %s\" to allow this",
+			lhs.Str(q.tm), o.Name().Str(q.tm))
+	}
+	return nil
+}
+
 func (q *checker) tcheckArg(n *a.Arg, inField *a.Field, genericType *a.TypeExpr, depth uint32) error {
 	if err := q.tcheckExpr(n.Value(), depth); err != nil {
 		return err
@@ -324,6 +465,19 @@ func (q *checker) tcheckArg(n *a.Arg, inField *a.Field, genericType *a.TypeExpr,
 	return nil
 }
 
+// tcheckBlock checks the statements of an if, while or iterate body, in a new
+// scope frame.
+func (q *checker) tcheckBlock(block []*a.Node) error {
+	q.scope.Push()
+	defer q.scope.Pop()
+	for _, o := range block {
+		if err := q.tcheckStatement(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (q *checker) tcheckLoop(n a.Loop) error {
 	for _, o := range n.Asserts() {
 		if err := q.tcheckAssert(o.Assert()); err != nil {
@@ -335,10 +489,13 @@ func (q *checker) tcheckLoop(n a.Loop) error {
 	defer func() {
 		q.jumpTargets = q.jumpTargets[:len(q.jumpTargets)-1]
 	}()
-	for _, o := range n.Body() {
-		if err := q.tcheckStatement(o); err != nil {
-			return err
-		}
+	if err := q.tcheckBlock(n.Body()); err != nil {
+		return err
+	}
+	if id := n.Label(); id != 0 && !q.usedLabels[n] {
+		filename, line := n.Node().Raw().FilenameLine()
+		q.c.warnf(filename, line, WarningUnusedLabel,
+			"label %q is not used by any break or continue", id.Str(q.tm))
 	}
 	return nil
 }
@@ -348,6 +505,10 @@ func (q *checker) tcheckExpr(n *a.Expr, depth uint32) error {
 		return fmt.Errorf("check: expression recursion depth too large")
 	}
 	depth++
+	if o := n.Node(); o.Kind() == a.KAssign {
+		return fmt.Errorf("check: assignment to %q is used as an expression; "+
+			"assignment is a statement, not an expression", o.Assign().LHS().Str(q.tm))
+	}
 
 	switch n.Operator().Flags() & (t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp) {
 	case 0:
@@ -367,12 +528,58 @@ func (q *checker) tcheckExpr(n *a.Expr, depth uint32) error {
 			return err
 		}
 	default:
-		return fmt.Errorf("check: unrecognized token.Key (0x%X) for tcheckExpr", n.Operator().Key())
+		return q.errOperatorFlags(n, "tcheckExpr")
 	}
 	n.Node().SetTypeChecked()
 	return nil
 }
 
+// errOperatorFlags returns the error for an operator whose token.ID has more
+// than one of the unary, binary and associative flags set, which means that
+// the token table, or whatever built the node, is wrong.
+func (q *checker) errOperatorFlags(n *a.Expr, pass string) error {
+	op := n.Operator()
+	return fmt.Errorf("check: operator %q (token.Key 0x%02X) has inconsistent flags 0x%04X for %s; "+
+		"want exactly one of unary (0x%04X), binary (0x%04X) or associative (0x%04X)",
+		op.AmbiguousForm().Str(q.tm), op.Key(), op.Flags()&(t.FlagsUnaryOp|t.FlagsBinaryOp|t.FlagsAssociativeOp), pass,
+		t.FlagsUnaryOp, t.FlagsBinaryOp, t.FlagsAssociativeOp)
+}
+
+// splitNumLiteral splits a numeric literal such as "42u8" or "0xFFu16" into
+// its digits, "42" or "0xFF", and its type suffix, "u8" or "u16", which may
+// be empty.
+func splitNumLiteral(s string) (digits string, suffix string) {
+	i, isDigit := 0, func(c byte) bool { return '0' <= c && c <= '9' }
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		i, isDigit = 2, func(c byte) bool {
+			return ('0' <= c && c <= '9') || ('A' <= c && c <= 'F') || ('a' <= c && c <= 'f')
+		}
+	}
+	for ; i < len(s) && isDigit(s[i]); i++ {
+	}
+	return s[:i], s[i:]
+}
+
+// numLiteralType returns the type of the numeric literal s, whose value is z:
+// the ideal type if it has no type suffix, otherwise the suffix's type, which
+// z must fit in.
+func (q *checker) numLiteralType(s string, suffix string, z *big.Int) (*a.TypeExpr, error) {
+	if suffix == "" {
+		return typeExprIdeal, nil
+	}
+	id := q.tm.ByName(suffix)
+	b := numTypeBounds[id.Key()]
+	if !id.IsNumType() || b[0] == nil || (b[0].Sign() == 0 && b[1].Sign() == 0) {
+		return nil, fmt.Errorf("check: numeric literal %q has type suffix %q, which is not a numeric type",
+			s, suffix)
+	}
+	if z.Cmp(b[0]) < 0 || z.Cmp(b[1]) > 0 {
+		return nil, fmt.Errorf("check: numeric literal %q is not within the bounds [%v..%v] of its type %q",
+			s, b[0], b[1], suffix)
+	}
+	return a.NewTypeExpr(0, 0, id, nil, nil, nil), nil
+}
+
 func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 	switch n.Operator().Key() {
 	case 0:
@@ -380,27 +587,58 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 		if id1.IsNumLiteral() {
 			z := big.NewInt(0)
 			s := id1.Str(q.tm)
-			if _, ok := z.SetString(s, 0); !ok {
+			if id1.IsFloatLiteral() {
+				return fmt.Errorf("check: floating-point literal %q is not yet supported, "+
+					"as every numeric type is an integer type", s)
+			}
+			digits, suffix := splitNumLiteral(s)
+			if _, ok := z.SetString(digits, 0); !ok {
 				return fmt.Errorf("check: invalid numeric literal %q", s)
 			}
+			typ, err := q.numLiteralType(s, suffix, z)
+			if err != nil {
+				return err
+			}
 			n.SetConstValue(z)
-			n.SetMType(typeExprIdeal)
+			n.SetMType(typ)
+			return nil
+
+		} else if id1.IsStrLiteral() {
+			// A string literal is a sequence of bytes. The tokenizer rejects
+			// control characters, including NUL, within string literals, so
+			// no literal can be truncated where C expects a NUL-terminated
+			// string, such as a status message.
+			//
+			// C string literals are read-only, so a string literal is not a
+			// "[] u8" slice value, which is writable.
+			if q.strLiteral != n {
+				return fmt.Errorf("check: string literal %s can only initialize a \"[N] u8\" array "+
+					"or be the receiver of \".length()\"", id1.Str(q.tm))
+			}
+			q.strLiteral = nil
+			n.SetMType(typeExprSliceU8)
 			return nil
 
 		} else if id1.IsIdent() {
-			if q.localVars != nil {
-				if typ, ok := q.localVars[id1]; ok {
-					n.SetMType(typ)
-					return nil
-				}
+			if typ, ok := q.scope.Lookup(id1); ok {
+				n.SetMType(typ)
+				return nil
 			}
 			if c, ok := q.c.consts[t.QID{0, id1}]; ok {
 				// TODO: check somewhere that a global ident (i.e. a const) is
 				// not directly in the LHS of an assignment.
 				n.SetGlobalIdent()
 				n.SetMType(c.XType())
+				// Consts are checked in dependency order, so a scalar const's
+				// value is already known.
+				if cv := c.Value().ConstValue(); cv != nil && c.XType().Decorator() == 0 {
+					n.SetConstValue(cv)
+				}
 				return nil
 			}
+			if id1 == q.tm.ByName("result") {
+				return q.tcheckResult(n)
+			}
 			// TODO: look for other (global) names: consts, funcs, statuses,
 			// structs from used packages.
 			return fmt.Errorf("check: unrecognized identifier %q", id1.Str(q.tm))
@@ -425,6 +663,12 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 
 	case t.KeyOpenParen, t.KeyTry:
 		// n is a function call.
+		if name := builtin.NumFuncName(q.tm, n); name != "" {
+			return q.tcheckBuiltInNumCall(n, name, depth)
+		}
+		if f := q.comptimeFunc(n); f != nil {
+			return q.tcheckComptimeCall(n, f, depth)
+		}
 
 		// TODO: be consistent about type-checking n.LHS().Expr() or
 		// n.LHS().Expr().LHS().Expr(). Doing this properly will probably
@@ -436,6 +680,14 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 			if err := q.tcheckExpr(foo, depth); err != nil {
 				return err
 			}
+			// The call is not resolved, but record its callee, if known, so
+			// that the call graph still reaches it.
+			if fTyp := foo.MType(); fTyp.Decorator() == 0 {
+				qid := fTyp.QID()
+				if f := q.c.funcs[t.QQID{qid[0], qid[1], n.LHS().Expr().Ident()}]; f != nil {
+					q.recordCallSite(n, f)
+				}
+			}
 			n.LHS().SetTypeChecked()
 			n.LHS().Expr().SetMType(typeExprPlaceholder) // HACK.
 			for _, o := range n.Args() {
@@ -474,6 +726,10 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 			return fmt.Errorf("check: %s is an index expression but %s has type %s, not a numeric type",
 				n.Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
 		}
+		if !isNonNegative(rhs) {
+			return fmt.Errorf("check: %s is an index expression but %s has type %s, "+
+				"array index must be unsigned", n.Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
+		}
 		n.SetMType(lTyp.Inner())
 		return nil
 
@@ -549,6 +805,9 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 		}
 		n.SetMType(typeExprList)
 		return nil
+
+	case t.KeySizeof:
+		return q.tcheckSizeof(n)
 	}
 
 	return fmt.Errorf("check: unrecognized token.Key (0x%X) in expression %q for tcheckExprOther",
@@ -557,6 +816,11 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 
 func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 	lhs := n.LHS().Expr()
+	if isThatMethod(q.tm, n, t.KeyLength, 0) {
+		if _, ok := strLiteralLength(q.tm, lhs.LHS().Expr()); ok {
+			q.strLiteral = lhs.LHS().Expr()
+		}
+	}
 	if err := q.tcheckExpr(lhs, depth); err != nil {
 		return err
 	}
@@ -564,6 +828,7 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 	if err != nil {
 		return err
 	}
+	q.recordCallSite(n, f)
 	if ne, fe := n.Effect(), f.Effect(); ne != fe {
 		return fmt.Errorf("check: %q has effect %q but %q has effect %q",
 			n.Str(q.tm), ne, f.QQID().Str(q.tm), fe)
@@ -574,12 +839,14 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 		genericType = lhs.MType().Receiver()
 	}
 
-	// Check that the func's in type matches the arguments.
+	// Check that the func's in type matches the arguments, filling in any
+	// omitted arguments from the in-params' default values.
 	inFields := f.In().Fields()
-	if len(inFields) != len(n.Args()) {
-		return fmt.Errorf("check: %q has %d arguments but %d were given",
-			lhs.MType().Str(q.tm), len(inFields), len(n.Args()))
+	args, err := q.fillDefaultArgs(n, inFields)
+	if err != nil {
+		return err
 	}
+	n.SetArgs(args)
 	for i, o := range n.Args() {
 		// TODO: inline tcheckArg here, after removing the special-cased hacks
 		// in tcheckExprOther.
@@ -613,9 +880,64 @@ func (q *checker) tcheckExprCall(n *a.Expr, depth uint32) error {
 			}
 		}
 	}
+
+	// A string literal's length is a constant.
+	if isThatMethod(q.tm, n, t.KeyLength, 0) {
+		if length, ok := strLiteralLength(q.tm, lhs.LHS().Expr()); ok {
+			n.SetConstValue(big.NewInt(int64(length)))
+		}
+	}
 	return nil
 }
 
+// strLiteralLength returns the length, in bytes, of n if it is a string
+// literal, such as 4 for "WUFF".
+func strLiteralLength(tm *t.Map, n *a.Expr) (int, bool) {
+	if n.Operator() != 0 || !n.Ident().IsStrLiteral() {
+		return 0, false
+	}
+	s, ok := t.Unescape(n.Ident().Str(tm))
+	return len(s), ok
+}
+
+// isArrayOfU8 returns whether typ is "[N] u8" for some N.
+func isArrayOfU8(typ *a.TypeExpr) bool {
+	return typ.Decorator().Key() == t.KeyOpenBracket && typ.Inner().Eq(typeExprU8)
+}
+
+// fillDefaultArgs returns the call n's arguments, matched in order against
+// inFields, with an argument that is omitted from n but that has a default
+// value replaced by that default value. It is an error for an argument without
+// a default value to be omitted.
+func (q *checker) fillDefaultArgs(n *a.Expr, inFields []*a.Node) ([]*a.Node, error) {
+	args := n.Args()
+	if len(args) == len(inFields) {
+		return args, nil
+	}
+	filled := make([]*a.Node, 0, len(inFields))
+	for _, o := range inFields {
+		field := o.Field()
+		if len(args) > 0 && args[0].Arg().Name() == field.Name() {
+			filled = append(filled, args[0])
+			args = args[1:]
+			continue
+		}
+		dv := field.DefaultValue()
+		if dv == nil {
+			return nil, fmt.Errorf("check: %q is missing argument %q, which has no default value",
+				n.Str(q.tm), field.Name().Str(q.tm))
+		}
+		// Each call gets its own copy of the default value, as type checking
+		// an argument modifies it in the context of that call.
+		filled = append(filled, a.NewArg(field.Name(), dv.Clone()).Node())
+	}
+	if len(args) != 0 {
+		return nil, fmt.Errorf("check: %q has %d arguments but %d were given",
+			n.LHS().Expr().MType().Str(q.tm), len(inFields), len(n.Args()))
+	}
+	return filled, nil
+}
+
 func isInSrc(tm *t.Map, n *a.Expr, methodName t.Key, nArgs int) bool {
 	callSuspendible := methodName != t.KeySinceMark &&
 		methodName != t.KeyMark &&
@@ -729,6 +1051,11 @@ func (q *checker) tcheckDot(n *a.Expr, depth uint32) error {
 		if s == nil && builtInTypeMap[lQID[1]] == nil {
 			return fmt.Errorf("check: no struct type %q found for expression %q", lTyp.Str(q.tm), lhs.Str(q.tm))
 		}
+		if s != nil && len(lTyp.TypeArgs()) != 0 {
+			if s, err = q.instantiateForDot(s, lTyp); err != nil {
+				return err
+			}
+		}
 	}
 
 	if s != nil {
@@ -741,6 +1068,11 @@ func (q *checker) tcheckDot(n *a.Expr, depth uint32) error {
 		}
 	}
 
+	if lhs.Operator().Key() == t.KeyOpenBracket {
+		// lhs is one step of a chain like "this.a[i].b", so say which step.
+		return fmt.Errorf("check: no field or method named %q found in type %q, the element type of %q, "+
+			"for expression %q", n.Ident().Str(q.tm), lTyp.Str(q.tm), lhs.LHS().Expr().Str(q.tm), n.Str(q.tm))
+	}
 	return fmt.Errorf("check: no field or method named %q found in type %q for expression %q",
 		n.Ident().Str(q.tm), lTyp.Str(q.tm), n.Str(q.tm))
 }
@@ -805,6 +1137,16 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 			return err
 		}
 		if lTyp.IsNumTypeOrIdeal() && rhs.IsNumType() {
+			if id := lhs.Ident(); lhs.Operator() == 0 && id.IsNumLiteral() {
+				if digits, suffix := splitNumLiteral(id.Str(q.tm)); suffix != "" {
+					return fmt.Errorf("check: conversion of %q, a literal with a type suffix, as type %q; "+
+						"write %q instead", lhs.Str(q.tm), rhs.Str(q.tm), digits+rhs.Unrefined().Str(q.tm))
+				}
+			}
+			if lTyp.Eq(rhs) {
+				q.warnf(WarningRedundantConversion, "redundant conversion of %q, already of type %q",
+					lhs.Str(q.tm), lTyp.Str(q.tm))
+			}
 			n.SetMType(rhs)
 			return nil
 		}
@@ -887,7 +1229,26 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 		if err != nil {
 			return err
 		}
+		if op.Key() == t.KeyXBinaryShiftL && lTyp.IsUnsignedInteger() {
+			if ncv, err = q.truncateShiftL(n, lTyp, ncv); err != nil {
+				return err
+			}
+		}
 		n.SetConstValue(ncv)
+	} else if op.Key() == t.KeyXBinaryShiftL && lTyp.IsUnsignedInteger() &&
+		(lcv != nil || lTyp.IsRefined()) {
+		if err := q.checkShiftLRange(n, lTyp, lhs, rhs); err != nil {
+			return err
+		}
+	} else if comparisonOps[0xFF&op.Key()] && !q.inAssert &&
+		lTyp.IsNumTypeOrIdeal() && rTyp.IsNumTypeOrIdeal() {
+		if ncv, err := q.evalRangeComparison(n, lhs, rhs); err != nil {
+			return err
+		} else if ncv != nil {
+			q.warnf(WarningConstantComparison, "comparison %q is always %t, given the operands' ranges",
+				n.Str(q.tm), ncv.Sign() != 0)
+			n.SetConstValue(ncv)
+		}
 	}
 
 	if comparisonOps[0xFF&op.Key()] {
@@ -901,6 +1262,100 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 	return nil
 }
 
+// truncateShiftL returns ncv, the constant value of n, "lhs << rhs", truncated
+// to the width of lTyp, lhs' unsigned integer type. It warns if any set bits
+// are lost.
+func (q *checker) truncateShiftL(n *a.Expr, lTyp *a.TypeExpr, ncv *big.Int) (*big.Int, error) {
+	_, tMax, err := typeBounds(q.tm, lTyp.Unrefined())
+	if err != nil || tMax == nil || ncv.Cmp(tMax) <= 0 {
+		return ncv, err
+	}
+	q.warnf(WarningShiftLostBits, "shift %q loses bits beyond the %d-bit width of type %q",
+		n.Str(q.tm), tMax.BitLen(), lTyp.Unrefined().Str(q.tm))
+	return big.NewInt(0).And(ncv, tMax), nil
+}
+
+// checkShiftLRange rejects n, "lhs << rhs", if it might shift set bits past
+// the width of lTyp, lhs' unsigned integer type, given the operands' ranges.
+// The author has to convert lhs to a wider type with "as" first.
+//
+// The bounds checker would reject such an n anyway, but with a less helpful
+// message about n's bounds.
+func (q *checker) checkShiftLRange(n *a.Expr, lTyp *a.TypeExpr, lhs *a.Expr, rhs *a.Expr) error {
+	_, tMax, err := typeBounds(q.tm, lTyp.Unrefined())
+	if err != nil || tMax == nil {
+		return err
+	}
+	_, lMax, err := argBounds(q.tm, lhs)
+	if err != nil || lMax == nil {
+		return err
+	}
+	_, rMax, err := argBounds(q.tm, rhs)
+	if err != nil || rMax == nil {
+		return err
+	}
+	if lMax.Sign() == 0 {
+		return nil
+	}
+	// Shifting a non-zero value by the type's width or more always loses bits.
+	// Checking this first also avoids a huge big.Int from a huge rMax.
+	if rMax.Cmp(big.NewInt(int64(tMax.BitLen()))) < 0 &&
+		big.NewInt(0).Lsh(lMax, uint(rMax.Uint64())).Cmp(tMax) <= 0 {
+		return nil
+	}
+	return fmt.Errorf("check: shift %q might lose bits beyond the %d-bit width of type %q; "+
+		"convert with \"as\" to a wider type first", n.Str(q.tm), tMax.BitLen(), lTyp.Unrefined().Str(q.tm))
+}
+
+// evalRangeComparison returns the constant result (0 for false, 1 for true)
+// of the comparison n, "lhs op rhs", if the operands' ranges alone determine
+// that result. Otherwise, it returns nil.
+//
+// Each operand must be a constant or have a refined type. An unrefined
+// operand's range is just its type's, and comparing against that, as in the
+// defensive "x >= 0" for an unsigned x, is ordinary code, not a mistake.
+func (q *checker) evalRangeComparison(n *a.Expr, lhs *a.Expr, rhs *a.Expr) (*big.Int, error) {
+	for _, o := range [...]*a.Expr{lhs, rhs} {
+		if o.ConstValue() == nil && !o.MType().IsRefined() {
+			return nil, nil
+		}
+	}
+	lMin, lMax, err := argBounds(q.tm, lhs)
+	if err != nil || lMin == nil {
+		return nil, err
+	}
+	rMin, rMax, err := argBounds(q.tm, rhs)
+	if err != nil || rMin == nil {
+		return nil, err
+	}
+
+	// always and never are whether "lhs op rhs" is true for every, or for no,
+	// pair of values in those ranges.
+	always, never := false, false
+	switch n.Operator().Key() {
+	case t.KeyXBinaryNotEq, t.KeyXBinaryEqEq:
+		always = lMin.Cmp(lMax) == 0 && rMin.Cmp(rMax) == 0 && lMin.Cmp(rMin) == 0
+		never = lMax.Cmp(rMin) < 0 || lMin.Cmp(rMax) > 0
+		if n.Operator().Key() == t.KeyXBinaryNotEq {
+			always, never = never, always
+		}
+	case t.KeyXBinaryLessThan:
+		always, never = lMax.Cmp(rMin) < 0, lMin.Cmp(rMax) >= 0
+	case t.KeyXBinaryLessEq:
+		always, never = lMax.Cmp(rMin) <= 0, lMin.Cmp(rMax) > 0
+	case t.KeyXBinaryGreaterEq:
+		always, never = lMin.Cmp(rMax) >= 0, lMax.Cmp(rMin) < 0
+	case t.KeyXBinaryGreaterThan:
+		always, never = lMin.Cmp(rMax) > 0, lMax.Cmp(rMin) <= 0
+	}
+	if always {
+		return one, nil
+	} else if never {
+		return zero, nil
+	}
+	return nil, nil
+}
+
 func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.Int, error) {
 	switch n.Operator().Key() {
 	case t.KeyXBinaryPlus:
@@ -1029,6 +1484,18 @@ swtch:
 	// TODO: also check t.KeyOpenParen.
 	case 0:
 		qid := typ.QID()
+		if _, ok := q.typeParams[qid]; ok && typ.Decorator() == 0 {
+			if typ.IsRefined() {
+				return fmt.Errorf("check: type parameter %q cannot be refined", typ.Str(q.tm))
+			}
+			break
+		}
+		if len(typ.TypeArgs()) != 0 {
+			if err := q.tcheckGenericTypeExpr(typ, depth); err != nil {
+				return err
+			}
+			break
+		}
 		if qid[1].IsNumType() {
 			for _, b := range typ.Bounds() {
 				if b == nil {
@@ -1051,6 +1518,9 @@ swtch:
 		}
 		for _, s := range q.c.structs {
 			if s.QID() == qid {
+				if len(s.TypeParams()) != 0 {
+					return fmt.Errorf("check: generic struct %q needs type arguments", typ.Str(q.tm))
+				}
 				break swtch
 			}
 		}
@@ -1064,6 +1534,10 @@ swtch:
 		if aLen.ConstValue() == nil {
 			return fmt.Errorf("check: %q is not constant", aLen.Str(q.tm))
 		}
+		if !isNonNegative(aLen) {
+			return fmt.Errorf("check: %q has type %s, array length must be unsigned",
+				aLen.Str(q.tm), aLen.MType().Str(q.tm))
+		}
 		fallthrough
 
 	// TODO: also check t.KeyNptr? Where else should we look for nptr?
@@ -1079,6 +1553,25 @@ swtch:
 	return nil
 }
 
+// isNonNegative returns whether the numeric expression n is known to be
+// non-negative: it is a non-negative constant, it has an unsigned integer type
+// or it has a refined type whose lower bound is non-negative.
+func isNonNegative(n *a.Expr) bool {
+	if cv := n.ConstValue(); cv != nil {
+		return cv.Sign() >= 0
+	}
+	typ := n.MType()
+	if typ.IsUnsignedInteger() {
+		return true
+	}
+	if min := typ.Min(); min != nil {
+		if cv := min.ConstValue(); cv != nil {
+			return cv.Sign() >= 0
+		}
+	}
+	return false
+}
+
 var comparisonOps = [256]bool{
 	t.KeyXBinaryNotEq:       true,
 	t.KeyXBinaryLessThan:    true,
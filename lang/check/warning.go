@@ -0,0 +1,145 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// WarningCategory is the structured code for a kind of Warning, such as
+// "redundant-conversion".
+type WarningCategory string
+
+const (
+	WarningConstantComparison  WarningCategory = "constant-comparison"
+	WarningNaming              WarningCategory = "naming"
+	WarningRedundantAbs        WarningCategory = "redundant-abs"
+	WarningRedundantConversion WarningCategory = "redundant-conversion"
+	WarningShiftLostBits       WarningCategory = "shift-lost-bits"
+	WarningUnreachableFunc     WarningCategory = "unreachable-func"
+	WarningUnusedSuspendible   WarningCategory = "unused-suspendible"
+	WarningUnusedLabel         WarningCategory = "unused-label"
+	WarningUnusedNoWarn        WarningCategory = "unused-nowarn"
+)
+
+// Warning is a diagnostic that, unlike an Error, does not stop the checker,
+// unless the Checker was told to treat warnings as errors.
+type Warning struct {
+	Category WarningCategory
+	Err      error
+	Filename string
+	Line     uint32
+}
+
+func (w *Warning) Error() string {
+	return fmt.Sprintf("%s at %s:%d [%s]", w.Err, w.Filename, w.Line, w.Category)
+}
+
+// SetWarningsAsErrors sets whether Err promotes any (non-allowed) warning to
+// an error.
+func (c *Checker) SetWarningsAsErrors(b bool) { c.warningsAsErrors = b }
+
+// AllowWarning suppresses all warnings of the given category, both from
+// Warnings and from Err.
+func (c *Checker) AllowWarning(category WarningCategory) {
+	if c.allowedWarnings == nil {
+		c.allowedWarnings = map[WarningCategory]bool{}
+	}
+	c.allowedWarnings[category] = true
+}
+
+// Warnings returns the warnings found during checking, in the order that they
+// were found, excluding those in allowed categories.
+func (c *Checker) Warnings() []*Warning {
+	ret := []*Warning(nil)
+	for _, w := range c.warnings {
+		if !c.allowedWarnings[w.Category] {
+			ret = append(ret, w)
+		}
+	}
+	return ret
+}
+
+// Err returns nil unless warnings are treated as errors, in which case it
+// returns an *Error for the first (non-allowed) warning, if any.
+func (c *Checker) Err() error {
+	if !c.warningsAsErrors {
+		return nil
+	}
+	ws := c.Warnings()
+	if len(ws) == 0 {
+		return nil
+	}
+	return &Error{
+		Err:      fmt.Errorf("%v (warning %q treated as an error)", ws[0].Err, ws[0].Category),
+		Filename: ws[0].Filename,
+		Line:     ws[0].Line,
+	}
+}
+
+// applyNoWarns removes those warnings suppressed by a "// wuffs:nowarn
+// category" comment, attached to the statement on the warning's line. A
+// suppression that matches no warning is itself warned about.
+func (c *Checker) applyNoWarns(files []*a.File) {
+	for _, f := range files {
+		f.Node().Walk(func(n *a.Node) error {
+			filename, line := n.Raw().FilenameLine()
+			for _, category := range n.Raw().NoWarn() {
+				used := false
+				ws := c.warnings[:0]
+				for _, w := range c.warnings {
+					if w.Filename == filename && w.Line == line && string(w.Category) == category {
+						used = true
+					} else {
+						ws = append(ws, w)
+					}
+				}
+				c.warnings = ws
+				if !used {
+					c.warnings = append(c.warnings, &Warning{
+						Category: WarningUnusedNoWarn,
+						Err:      fmt.Errorf("check: unused suppression of warning %q", category),
+						Filename: filename,
+						Line:     line,
+					})
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func (q *checker) warnf(category WarningCategory, format string, args ...interface{}) {
+	q.c.warnf(q.errFilename, q.errLine, category, format, args...)
+}
+
+func (c *Checker) warnf(filename string, line uint32, category WarningCategory, format string, args ...interface{}) {
+	w := &Warning{
+		Category: category,
+		Err:      fmt.Errorf("check: "+format, args...),
+		Filename: filename,
+		Line:     line,
+	}
+	// The same node can be type-checked more than once, so skip duplicates.
+	for _, o := range c.warnings {
+		if o.Category == w.Category && o.Filename == w.Filename && o.Line == w.Line &&
+			o.Err.Error() == w.Err.Error() {
+			return
+		}
+	}
+	c.warnings = append(c.warnings, w)
+}
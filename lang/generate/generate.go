@@ -37,6 +37,10 @@ type Generator func(packageName string, tm *t.Map, c *check.Checker, files []*a.
 func Do(args []string, g Generator) error {
 	flags := flag.FlagSet{}
 	packageName := flags.String("package_name", "", "the package name of the Wuffs input code")
+	warningsAsErrors := flags.Bool("warnings_as_errors", false, "whether to treat check warnings as errors")
+	buildTags := flags.String("build_tags", "", "comma-separated key=value build tags, such as target=wasm")
+	naming := flags.String("naming", "", "comma-separated kind=convention naming policy to lint against, "+
+		"such as const=SCREAMING_SNAKE_CASE,func=snake_case; kinds are const, func, struct, field and var")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -45,16 +49,35 @@ func Do(args []string, g Generator) error {
 		return fmt.Errorf("prohibited package name %q", *packageName)
 	}
 
+	tags, err := parseBuildTags(*buildTags)
+	if err != nil {
+		return err
+	}
+	policy, err := parseNamingPolicy(*naming)
+	if err != nil {
+		return err
+	}
+
 	tm := &t.Map{}
 	files, err := parseFiles(tm, flags.Args())
 	if err != nil {
 		return err
 	}
 
-	c, err := check.Check(tm, files, resolveUse)
+	c, err := check.Check(tm, files, resolveUse, &check.Options{
+		BuildTags: tags,
+		Naming:    policy,
+	})
 	if err != nil {
 		return err
 	}
+	c.SetWarningsAsErrors(*warningsAsErrors)
+	for _, w := range c.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
 
 	out, err := g(pkgName, tm, c, files)
 	if err != nil {
@@ -67,6 +90,54 @@ func Do(args []string, g Generator) error {
 	return nil
 }
 
+func parseBuildTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	if s == "" {
+		return tags, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid build tag %q, want key=value", kv)
+		}
+		tags[kv[:i]] = kv[i+1:]
+	}
+	return tags, nil
+}
+
+func parseNamingPolicy(s string) (*check.NamingPolicy, error) {
+	if s == "" {
+		return nil, nil
+	}
+	p := &check.NamingPolicy{}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid naming policy %q, want kind=convention", kv)
+		}
+		c := check.NamingConvention(kv[i+1:])
+		if !c.Valid() {
+			return nil, fmt.Errorf("invalid naming convention %q, want %s or %s",
+				c, check.NamingSnakeCase, check.NamingScreamingSnakeCase)
+		}
+		switch kv[:i] {
+		case "const":
+			p.Consts = c
+		case "func":
+			p.Funcs = c
+		case "struct":
+			p.Structs = c
+		case "field":
+			p.Fields = c
+		case "var":
+			p.Vars = c
+		default:
+			return nil, fmt.Errorf("invalid naming policy kind %q, want const, func, struct, field or var", kv[:i])
+		}
+	}
+	return p, nil
+}
+
 func checkPackageName(s string) string {
 	allUnderscores := true
 	for i := 0; i < len(s); i++ {
@@ -96,11 +167,13 @@ func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
 		if err != nil {
 			return nil, err
 		}
-		tokens, _, err := t.Tokenize(tm, filename, src)
+		tokens, comments, err := t.Tokenize(tm, filename, src)
 		if err != nil {
 			return nil, err
 		}
-		f, err := parse.Parse(tm, filename, tokens, nil)
+		f, err := parse.Parse(tm, filename, tokens, &parse.Options{
+			Comments: comments,
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -115,11 +188,16 @@ func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.
 		if err != nil {
 			return nil, err
 		}
-		tokens, _, err := t.Tokenize(tm, filename, src)
+		tokens, comments, err := t.Tokenize(tm, filename, src)
 		if err != nil {
 			return nil, err
 		}
-		f, err := parse.Parse(tm, filename, tokens, opts)
+		o := parse.Options{}
+		if opts != nil {
+			o = *opts
+		}
+		o.Comments = comments
+		f, err := parse.Parse(tm, filename, tokens, &o)
 		if err != nil {
 			return nil, err
 		}
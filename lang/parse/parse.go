@@ -18,6 +18,7 @@ package parse
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/google/wuffs/lang/base38"
 
@@ -28,8 +29,15 @@ import (
 type Options struct {
 	AllowBuiltIns              bool
 	AllowDoubleUnderscoreNames bool
+
+	// Comments are the comments returned by token.Tokenize. If non-nil, a
+	// "// wuffs:nowarn category" comment, on the line(s) immediately above a
+	// statement or top level declaration, is attached to that node.
+	Comments []string
 }
 
+const noWarnPrefix = "// wuffs:nowarn "
+
 func isDoubleUnderscore(s string) bool {
 	return len(s) >= 2 && s[0] == '_' && s[1] == '_'
 }
@@ -46,6 +54,12 @@ func Parse(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.File, e
 	if opts != nil {
 		p.opts = *opts
 	}
+	if p.opts.Comments != nil {
+		p.tokenLines = map[uint32]bool{}
+		for _, x := range src {
+			p.tokenLines[x.Line] = true
+		}
+	}
 	return p.parseFile()
 }
 
@@ -70,6 +84,10 @@ type parser struct {
 	src      []t.Token
 	opts     Options
 	lastLine uint32
+
+	// tokenLines are the lines that contain at least one token. It is only
+	// computed if opts.Comments is non-nil.
+	tokenLines map[uint32]bool
 }
 
 func (p *parser) line() uint32 {
@@ -89,15 +107,61 @@ func (p *parser) peek1() t.ID {
 func (p *parser) parseFile() (*a.File, error) {
 	topLevelDecls := []*a.Node(nil)
 	for len(p.src) > 0 {
+		// A "// wuffs:nowarn" comment can be above the "@[if etc]", if any,
+		// or between it and the declaration.
+		noWarn := p.noWarnCategories(p.src[0].Line)
+		buildIf := (*a.Expr)(nil)
+		if p.peek1().Key() == t.KeyAt {
+			var err error
+			buildIf, err = p.parseBuildIf()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(p.src) == 0 {
+			return nil, fmt.Errorf(`parse: "@[if etc]" has no declaration at %s:%d`, p.filename, p.line())
+		}
+		if buildIf != nil {
+			noWarn = append(noWarn, p.noWarnCategories(p.src[0].Line)...)
+		}
 		d, err := p.parseTopLevelDecl()
 		if err != nil {
 			return nil, err
 		}
+		d.Raw().SetNoWarn(noWarn)
+		d.Raw().SetBuildIf(buildIf)
 		topLevelDecls = append(topLevelDecls, d)
 	}
 	return a.NewFile(p.filename, topLevelDecls), nil
 }
 
+// parseBuildIf parses a "@[if cond]" attribute, which makes the following top
+// level declaration conditional on the build tags given to the checker.
+func (p *parser) parseBuildIf() (*a.Expr, error) {
+	p.src = p.src[1:]
+	for _, want := range [...]t.Key{t.KeyOpenBracket, t.KeyIf} {
+		if x := p.peek1().Key(); x != want {
+			got := p.tm.ByKey(x)
+			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`,
+				p.tm.ByKey(want), got, p.filename, p.line())
+		}
+		p.src = p.src[1:]
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if x := p.peek1().Key(); x != t.KeyCloseBracket {
+		got := p.tm.ByKey(x)
+		return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+	}
+	p.src = p.src[1:]
+	if p.peek1().Key() == t.KeySemicolon {
+		p.src = p.src[1:]
+	}
+	return cond, nil
+}
+
 func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 	flags := a.Flags(0)
 	line := p.src[0].Line
@@ -110,6 +174,14 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
 		}
 		p.src = p.src[1:]
+		alias := t.ID(0)
+		if k == t.KeyUse && p.peek1().Key() == t.KeyAs {
+			p.src = p.src[1:]
+			var err error
+			if alias, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		}
 		if x := p.peek1().Key(); x != t.KeySemicolon {
 			got := p.tm.ByKey(x)
 			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
@@ -126,7 +198,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			return a.NewPackageID(p.filename, line, path).Node(), nil
 		} else {
-			return a.NewUse(p.filename, line, path).Node(), nil
+			return a.NewUse(p.filename, line, path, alias).Node(), nil
 		}
 
 	case t.KeyPub:
@@ -203,6 +275,10 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				flags |= a.FlagsImpure | a.FlagsSuspendible
 				p.src = p.src[1:]
 			}
+			typeParams, err := p.parseTypeParams()
+			if err != nil {
+				return nil, err
+			}
 			inFields, err := p.parseList(t.KeyCloseParen, (*parser).parseFieldNode)
 			if err != nil {
 				return nil, err
@@ -231,9 +307,9 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
 			}
 			p.src = p.src[1:]
-			in := a.NewStruct(0, p.filename, line, t.IDIn, inFields)
-			out := a.NewStruct(0, p.filename, line, t.IDOut, outFields)
-			return a.NewFunc(flags, p.filename, line, id0, id1, in, out, asserts, body).Node(), nil
+			in := a.NewStruct(0, p.filename, line, t.IDIn, nil, inFields)
+			out := a.NewStruct(0, p.filename, line, t.IDOut, nil, outFields)
+			return a.NewFunc(flags, p.filename, line, id0, id1, typeParams, in, out, asserts, body).Node(), nil
 
 		case t.KeyError, t.KeySuspension:
 			keyword := p.src[0].ID
@@ -270,6 +346,10 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				flags |= a.FlagsSuspendible
 				p.src = p.src[1:]
 			}
+			typeParams, err := p.parseTypeParams()
+			if err != nil {
+				return nil, err
+			}
 			fields, err := p.parseList(t.KeyCloseParen, (*parser).parseFieldNode)
 			if err != nil {
 				return nil, err
@@ -279,7 +359,7 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
 			}
 			p.src = p.src[1:]
-			return a.NewStruct(flags, p.filename, line, name, fields).Node(), nil
+			return a.NewStruct(flags, p.filename, line, name, typeParams, fields).Node(), nil
 		}
 	}
 	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s:%d`, p.filename, line)
@@ -357,7 +437,56 @@ func (p *parser) parseList(stop t.Key, parseElem func(*parser) (*a.Node, error))
 	return nil, fmt.Errorf(`parse: expected %q at %s:%d`, p.tm.ByKey(stop), p.filename, p.line())
 }
 
+// parseTypeParams parses the optional "[T, U]" type parameters of a generic
+// struct or func declaration.
+func (p *parser) parseTypeParams() ([]*a.Node, error) {
+	if p.peek1().Key() != t.KeyOpenBracket {
+		return nil, nil
+	}
+	p.src = p.src[1:]
+	typeParams, err := p.parseList(t.KeyCloseBracket, (*parser).parseTypeParamNode)
+	if err != nil {
+		return nil, err
+	}
+	if x := p.peek1().Key(); x != t.KeyCloseBracket {
+		got := p.tm.ByKey(x)
+		return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+	}
+	p.src = p.src[1:]
+	if len(typeParams) == 0 {
+		return nil, fmt.Errorf(`parse: empty type parameter list at %s:%d`, p.filename, p.line())
+	}
+	return typeParams, nil
+}
+
+func (p *parser) parseTypeParamNode() (*a.Node, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	constraint := t.ID(0)
+	if p.peek1().Key() == t.KeyColon {
+		p.src = p.src[1:]
+		if len(p.src) == 0 {
+			return nil, fmt.Errorf(`parse: expected type constraint at %s:%d`, p.filename, p.line())
+		}
+		x := p.src[0]
+		if k := x.Key(); !x.IsIdent() && k != t.KeyPtr && k != t.KeyStruct {
+			got := p.tm.ByToken(x)
+			return nil, fmt.Errorf(`parse: expected type constraint, got %q at %s:%d`, got, p.filename, p.line())
+		}
+		p.src = p.src[1:]
+		constraint = x.ID
+	}
+	return a.NewTypeParam(constraint, name).Node(), nil
+}
+
 func (p *parser) parseFieldNode() (*a.Node, error) {
+	flags := a.Flags(0)
+	if p.peek1().Key() == t.KeyVar {
+		p.src = p.src[1:]
+		flags |= a.FlagsMutable
+	}
 	name, err := p.parseIdent()
 	if err != nil {
 		return nil, err
@@ -374,7 +503,7 @@ func (p *parser) parseFieldNode() (*a.Node, error) {
 			return nil, err
 		}
 	}
-	return a.NewField(name, typ, defaultValue).Node(), nil
+	return a.NewField(flags, name, typ, defaultValue).Node(), nil
 }
 
 func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
@@ -417,15 +546,52 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 	lhs, mhs := (*a.Expr)(nil), (*a.Expr)(nil)
 	if p.peek1().Key() == t.KeyOpenBracket {
+		// The brackets are either a refinement, such as "u32[..8]", or the
+		// type arguments of a generic struct, such as "ring_buffer[u8]". Try
+		// the former first, backtracking if it fails.
+		src := p.src
 		_, lhs, mhs, err = p.parseBracket(t.IDDotDot)
 		if err != nil {
-			return nil, err
+			p.src = src
+			typeArgs, err1 := p.parseTypeArgs()
+			if err1 != nil {
+				return nil, err
+			}
+			return a.NewGenericTypeExpr(pkg, name, typeArgs), nil
 		}
 	}
 
 	return a.NewTypeExpr(0, pkg, name, lhs.Node(), mhs, nil), nil
 }
 
+// parseTypeArgs parses the "[u8, u16]" type arguments of a generic struct
+// type.
+func (p *parser) parseTypeArgs() ([]*a.Node, error) {
+	if x := p.peek1().Key(); x != t.KeyOpenBracket {
+		got := p.tm.ByKey(x)
+		return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+	}
+	p.src = p.src[1:]
+	typeArgs, err := p.parseList(t.KeyCloseBracket, (*parser).parseTypeExprNode)
+	if err != nil {
+		return nil, err
+	}
+	if x := p.peek1().Key(); x != t.KeyCloseBracket {
+		got := p.tm.ByKey(x)
+		return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+	}
+	p.src = p.src[1:]
+	if len(typeArgs) == 0 {
+		return nil, fmt.Errorf(`parse: empty type argument list at %s:%d`, p.filename, p.line())
+	}
+	return typeArgs, nil
+}
+
+func (p *parser) parseTypeExprNode() (*a.Node, error) {
+	n, err := p.parseTypeExpr()
+	return n.Node(), err
+}
+
 // parseBracket parses "[i:j]", "[i:]", "[:j]" and "[:]". A double dot replaces
 // the colon if sep is t.IDDotDot instead of t.IDColon. If sep is t.IDColon, it
 // also parses "[x]". The returned op is sep for a range or refinement and
@@ -570,6 +736,7 @@ func (p *parser) parseStatement() (*a.Node, error) {
 	n, err := p.parseStatement1()
 	if n != nil {
 		n.Raw().SetFilenameLine(p.filename, line)
+		n.Raw().SetNoWarn(p.noWarnCategories(line))
 		if n.Kind() == a.KIterate {
 			for _, o := range n.Iterate().Variables() {
 				o.Raw().SetFilenameLine(p.filename, line)
@@ -579,6 +746,24 @@ func (p *parser) parseStatement() (*a.Node, error) {
 	return n, err
 }
 
+// noWarnCategories returns the categories named by any "// wuffs:nowarn"
+// comments on the comment-only lines immediately above the given line.
+func (p *parser) noWarnCategories(line uint32) (categories []string) {
+	if p.opts.Comments == nil {
+		return nil
+	}
+	for l := line - 1; l > 0 && int(l) < len(p.opts.Comments) && !p.tokenLines[l]; l-- {
+		c := p.opts.Comments[l]
+		if c == "" {
+			break
+		}
+		if strings.HasPrefix(c, noWarnPrefix) {
+			categories = append(categories, strings.Fields(c[len(noWarnPrefix):])...)
+		}
+	}
+	return categories
+}
+
 func (p *parser) parseLabel() (t.ID, error) {
 	if p.peek1().Key() == t.KeyColon {
 		p.src = p.src[1:]
@@ -770,9 +955,14 @@ func (p *parser) parseVar(inIterate bool) (*a.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	typ, err := p.parseTypeExpr()
-	if err != nil {
-		return nil, err
+	// A "var x = etc" without an explicit type has its type inferred, during
+	// type checking, from its initializer.
+	typ := (*a.TypeExpr)(nil)
+	if inIterate || p.peek1().Key() != t.KeyEq {
+		typ, err = p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
 	}
 	value := (*a.Expr)(nil)
 
@@ -813,12 +1003,13 @@ func (p *parser) parseDollarExpr() (*a.Expr, error) {
 		got := p.tm.ByKey(x)
 		return nil, fmt.Errorf(`parse: expected "$", got %q at %s:%d`, got, p.filename, p.line())
 	}
+	line := p.line()
 	p.src = p.src[1:]
 	args, err := p.parseList(t.KeyCloseParen, (*parser).parseExprNode)
 	if err != nil {
 		return nil, err
 	}
-	return a.NewExpr(0, t.IDDollar, 0, 0, nil, nil, nil, args), nil
+	return p.setLine(a.NewExpr(0, t.IDDollar, 0, 0, nil, nil, nil, args), line), nil
 }
 
 func (p *parser) parseTryExpr() (*a.Expr, error) {
@@ -826,6 +1017,7 @@ func (p *parser) parseTryExpr() (*a.Expr, error) {
 		got := p.tm.ByKey(x)
 		return nil, fmt.Errorf(`parse: expected "try", got %q at %s:%d`, got, p.filename, p.line())
 	}
+	line := p.line()
 	p.src = p.src[1:]
 	call, err := p.parseExpr()
 	if err != nil {
@@ -835,8 +1027,14 @@ func (p *parser) parseTryExpr() (*a.Expr, error) {
 		return nil, fmt.Errorf(`parse: expected function call after "try", got %q at %s:%d`,
 			call.Str(p.tm), p.filename, p.line())
 	}
-	return a.NewExpr(call.Node().Raw().Flags(), t.IDTry, 0, call.Ident(),
-		call.LHS(), call.MHS(), call.RHS(), call.Args()), nil
+	return p.setLine(a.NewExpr(call.Node().Raw().Flags(), t.IDTry, 0, call.Ident(),
+		call.LHS(), call.MHS(), call.RHS(), call.Args()), line), nil
+}
+
+// setLine records line, that of n's first token, on the newly built n.
+func (p *parser) setLine(n *a.Expr, line uint32) *a.Expr {
+	n.Node().Raw().SetFilenameLine(p.filename, line)
+	return n
 }
 
 func (p *parser) parseExprNode() (*a.Node, error) {
@@ -848,6 +1046,7 @@ func (p *parser) parseExprNode() (*a.Node, error) {
 }
 
 func (p *parser) parseExpr() (*a.Expr, error) {
+	line := p.line()
 	lhs, err := p.parseOperand()
 	if err != nil {
 		return nil, err
@@ -870,11 +1069,11 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 		}
 
 		if !x.IsAssociativeOp() || x != p.peek1() {
-			op := x.BinaryForm()
-			if op == 0 {
-				return nil, fmt.Errorf(`parse: internal error: no binary form for token.Key 0x%02X`, x.Key())
+			op, err := p.opForm(x, x.BinaryForm(), "binary", t.FlagsBinaryOp)
+			if err != nil {
+				return nil, err
 			}
-			return a.NewExpr(0, op, 0, 0, lhs.Node(), nil, rhs, nil), nil
+			return p.setLine(a.NewExpr(0, op, 0, 0, lhs.Node(), nil, rhs, nil), line), nil
 		}
 
 		args := []*a.Node{lhs.Node(), rhs}
@@ -886,16 +1085,35 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 			}
 			args = append(args, arg.Node())
 		}
-		op := x.AssociativeForm()
-		if op == 0 {
-			return nil, fmt.Errorf(`parse: internal error: no associative form for token.Key 0x%02X`, x.Key())
+		op, err := p.opForm(x, x.AssociativeForm(), "associative", t.FlagsAssociativeOp)
+		if err != nil {
+			return nil, err
 		}
-		return a.NewExpr(0, op, 0, 0, nil, nil, nil, args), nil
+		return p.setLine(a.NewExpr(0, op, 0, 0, nil, nil, nil, args), line), nil
 	}
 	return lhs, nil
 }
 
+// opForm returns op, the disambiguated form of the operator token x, after
+// checking that op exists and that its only operator flag is want. Failing
+// that means that the token table is wrong, and the checker would otherwise
+// reject the resultant node far from its cause.
+func (p *parser) opForm(x t.ID, op t.ID, form string, want t.Flags) (t.ID, error) {
+	if op == 0 {
+		return 0, fmt.Errorf(`parse: internal error: no %s form for token.Key 0x%02X at %s:%d`,
+			form, x.Key(), p.filename, p.line())
+	}
+	const opFlags = t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp
+	if got := op.Flags() & opFlags; got != want {
+		return 0, fmt.Errorf(`parse: internal error: %s form of %q (token.Key 0x%02X) has `+
+			`operator flags 0x%04X, want 0x%04X at %s:%d`,
+			form, x.Str(p.tm), op.Key(), got, want, p.filename, p.line())
+	}
+	return op, nil
+}
+
 func (p *parser) parseOperand() (*a.Expr, error) {
+	line := p.line()
 	switch x := p.peek1(); {
 	case x.IsUnaryOp():
 		p.src = p.src[1:]
@@ -903,15 +1121,21 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		op := x.UnaryForm()
-		if op == 0 {
-			return nil, fmt.Errorf(`parse: internal error: no unary form for token.Key 0x%02X`, x.Key())
+		op, err := p.opForm(x, x.UnaryForm(), "unary", t.FlagsUnaryOp)
+		if err != nil {
+			return nil, err
 		}
-		return a.NewExpr(0, op, 0, 0, nil, nil, rhs.Node(), nil), nil
+		return p.setLine(a.NewExpr(0, op, 0, 0, nil, nil, rhs.Node(), nil), line), nil
+
+	case x.IsStrLiteral():
+		// A string literal, unlike a numeric literal, can have suffixes,
+		// such as the method call in `"WUFF".length()`.
+		p.src = p.src[1:]
+		return p.parseSuffixes(p.setLine(a.NewExpr(0, 0, 0, x, nil, nil, nil, nil), line))
 
 	case x.IsLiteral():
 		p.src = p.src[1:]
-		return a.NewExpr(0, 0, 0, x, nil, nil, nil, nil), nil
+		return p.setLine(a.NewExpr(0, 0, 0, x, nil, nil, nil, nil), line), nil
 
 	default:
 		switch x.Key() {
@@ -928,6 +1152,24 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			p.src = p.src[1:]
 			return expr, nil
 
+		case t.KeySizeof:
+			p.src = p.src[1:]
+			if x := p.peek1().Key(); x != t.KeyOpenParen {
+				got := p.tm.ByKey(x)
+				return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+			}
+			p.src = p.src[1:]
+			typ, err := p.parseTypeExpr()
+			if err != nil {
+				return nil, err
+			}
+			if x := p.peek1().Key(); x != t.KeyCloseParen {
+				got := p.tm.ByKey(x)
+				return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+			}
+			p.src = p.src[1:]
+			return p.setLine(a.NewExpr(0, t.IDSizeof, 0, 0, nil, nil, typ.Node(), nil), line), nil
+
 		case t.KeyError, t.KeyStatus, t.KeySuspension:
 			keyword := x
 			p.src = p.src[1:]
@@ -939,7 +1181,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 				return nil, fmt.Errorf(`parse: expected string literal, got %q at %s:%d`, got, p.filename, p.line())
 			}
 			p.src = p.src[1:]
-			return a.NewExpr(0, keyword, statusPkg, message, nil, nil, nil, nil), nil
+			return p.setLine(a.NewExpr(0, keyword, statusPkg, message, nil, nil, nil, nil), line), nil
 		}
 	}
 
@@ -947,8 +1189,13 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	lhs := a.NewExpr(0, 0, 0, id, nil, nil, nil, nil)
+	return p.parseSuffixes(p.setLine(a.NewExpr(0, 0, 0, id, nil, nil, nil, nil), line))
+}
 
+// parseSuffixes parses any call, index, slice or selector suffixes, such as
+// "(x:y)", "[i]", "[i:j]" or ".f", that follow lhs.
+func (p *parser) parseSuffixes(lhs *a.Expr) (*a.Expr, error) {
+	_, line := lhs.Node().Raw().FilenameLine()
 	for {
 		flags := a.Flags(0)
 		switch p.peek1().Key() {
@@ -968,14 +1215,14 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			lhs = a.NewExpr(flags, t.IDOpenParen, 0, 0, lhs.Node(), nil, nil, args)
+			lhs = p.setLine(a.NewExpr(flags, t.IDOpenParen, 0, 0, lhs.Node(), nil, nil, args), line)
 
 		case t.KeyOpenBracket:
 			id0, mhs, rhs, err := p.parseBracket(t.IDColon)
 			if err != nil {
 				return nil, err
 			}
-			lhs = a.NewExpr(0, id0, 0, 0, lhs.Node(), mhs.Node(), rhs.Node(), nil)
+			lhs = p.setLine(a.NewExpr(0, id0, 0, 0, lhs.Node(), mhs.Node(), rhs.Node(), nil), line)
 
 		case t.KeyDot:
 			p.src = p.src[1:]
@@ -983,7 +1230,7 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			lhs = a.NewExpr(0, t.IDDot, 0, selector, lhs.Node(), nil, nil, nil)
+			lhs = p.setLine(a.NewExpr(0, t.IDDot, 0, selector, lhs.Node(), nil, nil, nil), line)
 		}
 	}
 }
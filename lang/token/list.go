@@ -44,7 +44,7 @@ const (
 	FlagsAssign            = Flags(0x1000)
 	FlagsImplicitSemicolon = Flags(0x2000)
 	FlagsNumType           = Flags(0x4000)
-	flagsUnused            = Flags(0x8000)
+	FlagsFloatLiteral      = Flags(0x8000)
 )
 
 // Key is the high 16 bits of an ID. It is the map key for a Map.
@@ -81,6 +81,7 @@ func (x ID) IsBinaryOp() bool          { return Flags(x)&FlagsBinaryOp != 0 }
 func (x ID) IsAssociativeOp() bool     { return Flags(x)&FlagsAssociativeOp != 0 }
 func (x ID) IsLiteral() bool           { return Flags(x)&FlagsLiteral != 0 }
 func (x ID) IsNumLiteral() bool        { return Flags(x)&FlagsNumLiteral != 0 }
+func (x ID) IsFloatLiteral() bool      { return Flags(x)&FlagsFloatLiteral != 0 }
 func (x ID) IsStrLiteral() bool        { return Flags(x)&FlagsStrLiteral != 0 }
 func (x ID) IsIdent() bool             { return Flags(x)&FlagsIdent != 0 }
 func (x ID) IsOpen() bool              { return Flags(x)&FlagsOpen != 0 }
@@ -141,6 +142,7 @@ func (t Token) IsBinaryOp() bool          { return Flags(t.ID)&FlagsBinaryOp !=
 func (t Token) IsAssociativeOp() bool     { return Flags(t.ID)&FlagsAssociativeOp != 0 }
 func (t Token) IsLiteral() bool           { return Flags(t.ID)&FlagsLiteral != 0 }
 func (t Token) IsNumLiteral() bool        { return Flags(t.ID)&FlagsNumLiteral != 0 }
+func (t Token) IsFloatLiteral() bool      { return Flags(t.ID)&FlagsFloatLiteral != 0 }
 func (t Token) IsStrLiteral() bool        { return Flags(t.ID)&FlagsStrLiteral != 0 }
 func (t Token) IsIdent() bool             { return Flags(t.ID)&FlagsIdent != 0 }
 func (t Token) IsOpen() bool              { return Flags(t.ID)&FlagsOpen != 0 }
@@ -184,6 +186,7 @@ const (
 	KeyCloseBracket = Key(IDCloseBracket >> KeyShift)
 	KeyOpenCurly    = Key(IDOpenCurly >> KeyShift)
 	KeyCloseCurly   = Key(IDCloseCurly >> KeyShift)
+	KeyAt           = Key(IDAt >> KeyShift)
 
 	KeyDot       = Key(IDDot >> KeyShift)
 	KeyDotDot    = Key(IDDotDot >> KeyShift)
@@ -263,6 +266,7 @@ const (
 	KeyTry        = Key(IDTry >> KeyShift)
 	KeyIterate    = Key(IDIterate >> KeyShift)
 	KeyYield      = Key(IDYield >> KeyShift)
+	KeySizeof     = Key(IDSizeof >> KeyShift)
 
 	KeyFalse = Key(IDFalse >> KeyShift)
 	KeyTrue  = Key(IDTrue >> KeyShift)
@@ -376,6 +380,7 @@ const (
 	IDCloseBracket = ID(0x13<<KeyShift | FlagsClose | FlagsTightLeft | FlagsImplicitSemicolon)
 	IDOpenCurly    = ID(0x14<<KeyShift | FlagsOpen)
 	IDCloseCurly   = ID(0x15<<KeyShift | FlagsClose | FlagsImplicitSemicolon)
+	IDAt           = ID(0x16<<KeyShift | FlagsTightRight)
 
 	IDDot       = ID(0x18<<KeyShift | FlagsTightLeft | FlagsTightRight)
 	IDDotDot    = ID(0x19<<KeyShift | FlagsTightLeft | FlagsTightRight)
@@ -455,6 +460,7 @@ const (
 	IDTry        = ID(0x67<<KeyShift | FlagsOther)
 	IDIterate    = ID(0x68<<KeyShift | FlagsOther)
 	IDYield      = ID(0x69<<KeyShift | FlagsOther)
+	IDSizeof     = ID(0x6A<<KeyShift | FlagsOther)
 
 	IDFalse = ID(0x70<<KeyShift | FlagsLiteral | FlagsImplicitSemicolon)
 	IDTrue  = ID(0x71<<KeyShift | FlagsLiteral | FlagsImplicitSemicolon)
@@ -589,6 +595,7 @@ var builtInsByKey = [nBuiltInKeys]struct {
 	KeyCloseBracket: {"]", IDCloseBracket},
 	KeyOpenCurly:    {"{", IDOpenCurly},
 	KeyCloseCurly:   {"}", IDCloseCurly},
+	KeyAt:           {"@", IDAt},
 
 	KeyDot:       {".", IDDot},
 	KeyDotDot:    {"..", IDDotDot},
@@ -667,6 +674,7 @@ var builtInsByKey = [nBuiltInKeys]struct {
 	KeyTry:        {"try", IDTry},
 	KeyIterate:    {"iterate", IDIterate},
 	KeyYield:      {"yield", IDYield},
+	KeySizeof:     {"sizeof", IDSizeof},
 
 	KeyFalse: {"false", IDFalse},
 	KeyTrue:  {"true", IDTrue},
@@ -752,6 +760,7 @@ var squiggles = [256]ID{
 	']': IDCloseBracket,
 	'{': IDOpenCurly,
 	'}': IDCloseCurly,
+	'@': IDAt,
 
 	',': IDComma,
 	'?': IDQuestion,
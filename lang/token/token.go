@@ -57,6 +57,9 @@ func (m *Map) Insert(name string) (ID, error) {
 	flags := FlagsImplicitSemicolon
 	if numeric(name[0]) {
 		flags |= FlagsLiteral | FlagsNumLiteral
+		if isFloatLiteral(name) {
+			flags |= FlagsFloatLiteral
+		}
 	} else if name[0] == '"' {
 		flags |= FlagsLiteral | FlagsStrLiteral
 	} else {
@@ -108,6 +111,41 @@ func numeric(c byte) bool {
 	return ('0' <= c && c <= '9')
 }
 
+// floatSuffix returns the index just after any fractional part and exponent
+// of a decimal constant that ends at src[j]. A "." must be followed by a digit,
+// so that "0..9" is still a range and "x.0" is still not a float.
+func floatSuffix(src []byte, j int) int {
+	if j+1 < len(src) && src[j] == '.' && numeric(src[j+1]) {
+		for j += 2; j < len(src) && numeric(src[j]); j++ {
+		}
+	}
+	if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+		k := j + 1
+		if k < len(src) && (src[k] == '+' || src[k] == '-') {
+			k++
+		}
+		if k < len(src) && numeric(src[k]) {
+			for j = k + 1; j < len(src) && numeric(src[j]); j++ {
+			}
+		}
+	}
+	return j
+}
+
+// isFloatLiteral returns whether name, a numeric constant, is a floating-point
+// constant, such as "3.14" or "6.02e23", instead of an integer constant.
+func isFloatLiteral(name string) bool {
+	if len(name) > 1 && name[0] == '0' && (name[1] == 'x' || name[1] == 'X') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c == '.' || c == 'e' || c == 'E' {
+			return true
+		}
+	}
+	return false
+}
+
 func hasPrefix(a []byte, s string) bool {
 	if len(s) == 0 {
 		return true
@@ -198,10 +236,10 @@ loop:
 			// TODO: 0b11 binary numbers.
 			//
 			// TODO: allow underscores like 0b1000_0000_1111?
-			j, isDigit := i+1, numeric
+			j, isDigit, isHex := i+1, numeric, false
 			if c == '0' && j < len(src) {
 				if next := src[j]; next == 'x' || next == 'X' {
-					j, isDigit = j+1, hexaNumeric
+					j, isDigit, isHex = j+1, hexaNumeric, true
 				} else if numeric(next) {
 					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d", filename, line)
 				}
@@ -211,6 +249,20 @@ loop:
 					return nil, nil, fmt.Errorf("token: constant too long at %s:%d", filename, line)
 				}
 			}
+			// A decimal constant can continue as a floating-point constant,
+			// such as "3.14" or "6.02e23". There are no floating-point types
+			// yet, but tokenizing these as one token, instead of "3", "." and
+			// "14", lets the checker give a clear error message.
+			if !isHex {
+				j = floatSuffix(src, j)
+			}
+			// A constant can end with a type suffix, such as the "u8" in
+			// "42u8". The checker, not the tokenizer, validates the suffix.
+			for ; j < len(src) && alphaNumeric(src[j]); j++ {
+			}
+			if j-i > maxTokenSize {
+				return nil, nil, fmt.Errorf("token: constant too long at %s:%d", filename, line)
+			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err